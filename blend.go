@@ -0,0 +1,167 @@
+package main
+
+import "context"
+import "encoding/json"
+import "fmt"
+import "log"
+import "os"
+import "sort"
+import "time"
+
+// A blend zone stitches several models into one timeline - HRRR for the
+// first day, then the NAM nest, then GFS. It lists component zones,
+// highest resolution first. Each is fetched over the blend's area (and
+// stored under its geo), then every valid time goes into one composite
+// from the first component that has it, regridded onto the blend's grid.
+// Accumulations keep each model's own interval. A .json file next to the
+// composite records which model supplied each step:
+//
+//   {"zone": "sf-blend", "steps": [{"valid": "2026-10-16T13:00:00Z",
+//     "zone": "sf", "model": "hrrr", "run": "2026-10-16T12:00:00Z", "forecast": 1}, ...]}
+
+// A component's fetched composite
+type blendPart struct {
+	zone  string
+	model string
+	run   time.Time
+	fn    string
+}
+
+type blendStep struct {
+	Valid    time.Time `json:"valid"`
+	Zone     string    `json:"zone"`
+	Model    string    `json:"model"`
+	Run      time.Time `json:"run"`
+	Forecast int       `json:"forecast"` // Hours
+}
+
+type blendInfo struct {
+	Zone  string      `json:"zone"`
+	Steps []blendStep `json:"steps"`
+}
+
+// Fetch each of the blend zone's components, then write the blend
+func runBlend(ctx context.Context, id string) error {
+	b := zones[id]
+	var parts []blendPart
+	for _, c := range b.blend {
+		if err := useZone(c); err != nil {
+			return err
+		}
+		Z.geo, Z.longitude, Z.latitude = b.geo, b.longitude, b.latitude
+		log.Printf("Fetching blend %s component %s model %s\n", id, c, Z.model)
+		if err := fetch(ctx); err != nil && err != errRunExists {
+			log.Printf("Fetch %s: %v\n", c, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fn := grb2Directory() + "/" + runName(zulu) + ".grb2"
+		if _, err := os.Stat(fn); err != nil {
+			log.Printf("Blend %s: no %s composite, leaving it out\n", id, c)
+			continue
+		}
+		parts = append(parts, blendPart{zone: c, model: Z.model, run: zulu, fn: fn})
+	}
+	zone, Z = id, b
+	if len(parts) == 0 {
+		return fmt.Errorf("no components fetched")
+	}
+	name := fmt.Sprintf("%s_%s_blend", parts[0].run.Format("2006-01-02_15z"), b.geo)
+	return writeBlend(grb2Directory()+"/"+name, id, b, parts)
+}
+
+// Write the blend to base.grb2 and the record of its steps to base.json
+func writeBlend(base, id string, b Zone, parts []blendPart) error {
+	// Each component's fields by valid time
+	byValid := make([]map[time.Time][]*grib2Field, len(parts))
+	times := map[time.Time]bool{}
+	var start time.Time
+	for n, p := range parts {
+		msgs, err := readGrib2File(p.fn)
+		if err != nil {
+			return err
+		}
+		byValid[n] = map[time.Time][]*grib2Field{}
+		for _, f := range gribFields(msgs) {
+			t := f.validTime()
+			byValid[n][t] = append(byValid[n][t], f)
+			times[t] = true
+			// The timeline starts with the highest resolution model
+			if n == 0 && (start.IsZero() || t.Before(start)) {
+				start = t
+			}
+		}
+	}
+	var timeline []time.Time
+	for t := range times {
+		if !t.Before(start) {
+			timeline = append(timeline, t)
+		}
+	}
+	sort.Slice(timeline, func(i, j int) bool { return timeline[i].Before(timeline[j]) })
+
+	grb2 := base + ".grb2"
+	out, err := os.Create(grb2)
+	if err != nil {
+		return err
+	}
+	info := blendInfo{Zone: id}
+	var dst *gribGrid
+	for _, t := range timeline {
+		n := 0
+		for len(byValid[n][t]) == 0 {
+			n++
+		}
+		p, ref := parts[n], byValid[n][t][0].refTime
+		for _, f := range rotateWinds(byValid[n][t]) {
+			src, err := f.grid()
+			if err == nil && dst == nil {
+				dst = latLonGrid(b.longitude, b.latitude, b.regrid.spacing, src.earth)
+			}
+			var msg []byte
+			if err == nil {
+				msg, err = regridField(f, dst, b.regrid.method)
+			}
+			if err != nil {
+				log.Printf("%s: can't regrid %s: %v\n", p.zone, f, err)
+				continue
+			}
+			if _, err := out.Write(msg); err != nil {
+				out.Close()
+				return err
+			}
+		}
+		info.Steps = append(info.Steps, blendStep{t, p.zone, p.model, ref, int(t.Sub(ref).Hours())})
+		if verbose {
+			log.Printf("%s from %s\n", t.Format("2006-01-02 15z"), p.zone)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	st, _ := os.Stat(grb2)
+	log.Printf("GRIB %s %s (%d bytes)\n", grb2, prettyInt(st.Size()), st.Size())
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(base+".json", append(data, '\n'), 0644)
+}
+
+func checkBlend(id string, z Zone) error {
+	for _, c := range z.blend {
+		cz, ok := zones[c]
+		if !ok {
+			return fmt.Errorf("zone %s: unknown blend component '%s'", id, c)
+		}
+		if len(cz.blend) > 0 || cz.perMember {
+			return fmt.Errorf("zone %s: component %s can't be blended", id, c)
+		}
+	}
+	if z.regrid.spacing <= 0 {
+		return fmt.Errorf("zone %s: a blend needs a regrid spacing", id)
+	}
+	return checkRegrid(z.regrid)
+}
@@ -0,0 +1,112 @@
+package main
+
+import "encoding/json"
+import "math"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+// A high resolution model with hours 1-3 over a lower resolution one every
+// 3 hours: the blend starts with the first and fills in from the second
+func TestWriteBlend(t *testing.T) {
+	dir := t.TempDir()
+	run := time.Date(2026, 7, 6, 12, 0, 0, 0, time.UTC)
+	write := func(name string, g *gribGrid, value float64, hours ...int) blendPart {
+		var data []byte
+		for _, h := range hours {
+			vals := make([]float64, g.nx*g.ny)
+			for i := range vals {
+				vals[i] = value + float64(h)
+			}
+			data = append(data, testMessage(g, 0, 0, h, 1, vals)...)
+		}
+		fn := filepath.Join(dir, name+".grb2")
+		if err := os.WriteFile(fn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return blendPart{zone: name, model: name, run: run, fn: fn}
+	}
+	parts := []blendPart{
+		write("fine", testLatLonGrid(11, 11, 38.5, 237, 0.1), 100, 1, 2, 3),
+		write("coarse", testLatLonGrid(3, 3, 39, 236.5, 1), 200, 0, 3, 6),
+	}
+	b := Zone{geo: "test", longitude: Longitude{-122.8, -122.2}, latitude: Latitude{38.4, 37.8}, regrid: Regrid{spacing: 0.2}}
+	base := filepath.Join(dir, "blend")
+	if err := writeBlend(base, "test-blend", b, parts); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := readGrib2File(base + ".grb2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		zone  string
+		hour  int
+		value float64
+	}{{"fine", 1, 101}, {"fine", 2, 102}, {"fine", 3, 103}, {"coarse", 6, 206}}
+	fields := gribFields(msgs)
+	if len(fields) != len(want) {
+		t.Fatalf("%d fields, want %d", len(fields), len(want))
+	}
+	for i, w := range want {
+		f := fields[i]
+		g, err := f.grid()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.nx != 4 || g.ny != 4 || g.la1 != 38.4 || g.lo1 != 237.2 || f.forecast != time.Duration(w.hour)*time.Hour {
+			t.Errorf("step %d: %s on %dx%d from %g,%g", i, f, g.nx, g.ny, g.la1, g.lo1)
+		}
+		vals, err := f.values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range vals {
+			if math.Abs(v-w.value) > 0.01 {
+				t.Errorf("step %d: %g, want %g", i, v, w.value)
+				break
+			}
+		}
+	}
+
+	data, err := os.ReadFile(base + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info blendInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Zone != "test-blend" || len(info.Steps) != len(want) {
+		t.Fatalf("%s", data)
+	}
+	for i, w := range want {
+		s := info.Steps[i]
+		if s.Zone != w.zone || s.Forecast != w.hour || !s.Run.Equal(run) || !s.Valid.Equal(run.Add(time.Duration(w.hour)*time.Hour)) {
+			t.Errorf("step %d: %+v", i, s)
+		}
+	}
+}
+
+func TestCheckBlend(t *testing.T) {
+	tests := []struct {
+		z    Zone
+		want string
+	}{
+		{Zone{blend: []string{"sf", "sf96"}, regrid: Regrid{spacing: 0.02}}, ""},
+		{Zone{blend: []string{"sf", "nowhere"}, regrid: Regrid{spacing: 0.02}}, "zone b: unknown blend component 'nowhere'"},
+		{Zone{blend: []string{"sf", "sf-blend"}, regrid: Regrid{spacing: 0.02}}, "zone b: component sf-blend can't be blended"},
+		{Zone{blend: []string{"sf", "sf96"}}, "zone b: a blend needs a regrid spacing"},
+	}
+	for _, tc := range tests {
+		got := ""
+		if err := checkBlend("b", tc.z); err != nil {
+			got = err.Error()
+		}
+		if got != tc.want {
+			t.Errorf("%v: %q, want %q", tc.z.blend, got, tc.want)
+		}
+	}
+}
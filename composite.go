@@ -0,0 +1,70 @@
+package main
+
+import "bytes"
+import "log"
+import "path/filepath"
+
+// Build the part of the composite GRIB that comes from one forecast file,
+// applying any post-processing the zone asks for: winds are rotated to
+// earth-relative, fields regridded, then wind speed and direction derived
+// from the regridded U and V - a direction interpolated across north would
+// go the long way round. The file is validated either way; a file that
+// doesn't parse is an error.
+func compositeData(fn string) ([]byte, error) {
+	msgs, err := readGrib2File(fn)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	derive := Z.deriveWinds || deriveWinds
+	if Z.regrid.spacing == 0 && !Z.earthWinds && !earthWinds && !derive {
+		for _, m := range msgs {
+			out.Write(m.raw)
+		}
+		return out.Bytes(), nil
+	}
+
+	// Regridding grid-relative winds would make them relative to nothing
+	fields := gribFields(msgs)
+	if Z.regrid.spacing != 0 || Z.earthWinds || earthWinds {
+		fields = rotateWinds(fields)
+	}
+	if Z.regrid.spacing != 0 {
+		fields = regridFields(filepath.Base(fn), fields)
+	}
+	if derive {
+		fields = append(fields, derivedWinds(fields, Z.gustFactor || gustFactor)...)
+	}
+	for _, f := range fields {
+		out.Write(f.message())
+	}
+	return out.Bytes(), nil
+}
+
+// The fields on the zone's lat/lon grid. A field that can't be regridded
+// is kept as it is.
+func regridFields(name string, fields []*grib2Field) []*grib2Field {
+	var dst *gribGrid
+	regridded := make([]*grib2Field, 0, len(fields))
+	for _, f := range fields {
+		src, err := f.grid()
+		if err == nil && dst == nil {
+			dst = latLonGrid(Z.longitude, Z.latitude, Z.regrid.spacing, src.earth)
+		}
+		var msg []byte
+		if err == nil {
+			msg, err = regridField(f, dst, Z.regrid.method)
+		}
+		var m *grib2Message
+		if err == nil {
+			m, err = parseGrib2Message(msg, 0)
+		}
+		if err != nil {
+			log.Printf("%s: can't regrid %s: %v\n", name, f, err)
+			regridded = append(regridded, f)
+			continue
+		}
+		regridded = append(regridded, m.fields[0])
+	}
+	return regridded
+}
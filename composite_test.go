@@ -0,0 +1,57 @@
+package main
+
+import "math"
+import "os"
+import "path/filepath"
+import "testing"
+
+// A 10 m/s wind from 350 degrees on the west side of the grid and from 10
+// on the east, regridded halfway between: the derived direction is north,
+// not the 180 an interpolated direction would give
+func TestCompositeDataDerivesAfterRegrid(t *testing.T) {
+	saveZ := Z
+	defer func() { Z = saveZ }()
+	Z = Zone{longitude: Longitude{-123, -122}, latitude: Latitude{38, 37}, regrid: Regrid{spacing: 0.5}, deriveWinds: true}
+
+	src := testLatLonGrid(2, 2, 38, 237, 1)
+	from := []float64{350, 10, 350, 10}
+	u, v := make([]float64, len(from)), make([]float64, len(from))
+	for i, d := range from {
+		u[i], v[i] = -10*math.Sin(radians(d)), -10*math.Cos(radians(d))
+	}
+	fn := filepath.Join(t.TempDir(), "f006.grib2")
+	data := append(testMessage(src, 2, 2, 6, 3, u), testMessage(src, 2, 3, 6, 3, v)...)
+	if err := os.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := compositeData(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := parseGrib2(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]float64{}
+	for _, f := range gribFields(msgs) {
+		g, err := f.grid()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.nx != 3 || g.ny != 3 {
+			t.Errorf("%s on %dx%d", f, g.nx, g.ny)
+		}
+		if got[f.name()], err = f.values(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mid := 10 * math.Cos(radians(10))
+	for i, want := range []float64{350, 0, 10, 350, 0, 10, 350, 0, 10} {
+		if i >= len(got["WDIR"]) || math.Abs(math.Remainder(got["WDIR"][i]-want, 360)) > 0.5 {
+			t.Errorf("WDIR %v, want %g at %d", got["WDIR"], want, i)
+			break
+		}
+	}
+	checkValues(t, got["WIND"], []float64{10, mid, 10, 10, mid, 10, 10, mid, 10}, 0.01)
+}
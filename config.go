@@ -0,0 +1,509 @@
+package main
+
+import "os"
+import "bytes"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "io"
+import "log"
+import "math"
+import "path/filepath"
+import "reflect"
+import "runtime"
+import "strings"
+import "time"
+
+// Zones and models can be defined in JSON or TOML (see toml.go) config files
+// so new race areas don't need a rebuild. Files are read in order -
+// team-shared, per-user, then the file named with -config - and each is
+// merged over the compiled-in defaults. Only the keys present in a file
+// override an existing entry. A file ending .toml is TOML, anything else JSON.
+//
+// {
+//   "zones": {
+//     "rbyc": {
+//       "description": "Richardson Bay (18 hour hrrr)",
+//       "geo":         "rbyc",
+//       "model":       "hrrr",
+//       "longitude":   [-122.6, -122.3],
+//       "latitude":    [38.0, 37.8],
+//       "modelLevels": ["10_m_above_ground"],
+//       "modelVars":   ["UGRD", "VGRD", "GUST"]
+//     }
+//   },
+//   "models": {
+//     "hrrr": { "end": "95m" }
+//   }
+// }
+
+var configFile string
+
+// Zones & models defined or changed by config files, checked after loading
+var configZones = map[string]bool{}
+var configModels = map[string]bool{}
+
+type zoneConfig struct {
+	Description *string     `json:"description"`
+	Geo         *string     `json:"geo"`
+	Model       *string     `json:"model"`
+	Longitude   *[2]float64 `json:"longitude"` // [west, east]
+	Latitude    *[2]float64 `json:"latitude"`  // [north, south]
+	ModelLevels *[]string   `json:"modelLevels"`
+	ModelVars   *[]string   `json:"modelVars"`
+
+	RequireAllFields *bool         `json:"requireAllFields"`
+	Regrid           *regridConfig `json:"regrid"`
+	EarthWinds       *bool         `json:"earthWinds"`
+	DeriveWinds      *bool         `json:"deriveWinds"`
+	GustFactor       *bool         `json:"gustFactor"`
+
+	Storm    *string  `json:"storm"`
+	StormBox *float64 `json:"stormBox"`
+
+	Members   *[]string `json:"members"`
+	PerMember *bool     `json:"perMember"`
+
+	EnsembleStats *bool      `json:"ensembleStats"`
+	Thresholds    *[]float64 `json:"thresholds"` // Knots
+
+	Blend *[]string `json:"blend"`
+
+	Points *[]pointConfig `json:"points"`
+}
+
+type pointConfig struct {
+	Name string  `json:"name"`
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+}
+
+type regridConfig struct {
+	Spacing float64 `json:"spacing"` // Degrees
+	Method  string  `json:"method"`  // bilinear or nearest
+}
+
+type modelConfig struct {
+	Fn                *string `json:"fn"`
+	ModelFrequency    *string `json:"modelFrequency"`
+	ForecastFrequency *string `json:"forecastFrequency"`
+	Horizon           *string `json:"horizon"`
+	Start             *string `json:"start"`
+	End               *string `json:"end"`
+	Baseurl           *string `json:"baseurl"`
+	Baseurlfn         *string `json:"baseurlfn"`
+	Mirrorurl         *string `json:"mirrorurl"`
+	Source            *string `json:"source"`
+	Probeurl          *string `json:"probeurl"`
+
+	Steps    *[]stepConfig   `json:"steps"`
+	Horizons *map[int]string `json:"horizons"` // Cycle hour to horizon
+	Stormurl *string         `json:"stormurl"`
+}
+
+type stepConfig struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Step string `json:"step"`
+}
+
+type configDoc struct {
+	Zones  map[string]zoneConfig  `json:"zones"`
+	Models map[string]modelConfig `json:"models"`
+}
+
+// Where to look for config files, lowest priority first. Missing files are
+// skipped; the -config file must exist.
+func configPaths() []string {
+	var paths []string
+	if shared := os.Getenv("NOMADS_SHARED_CONFIG"); shared != "" {
+		paths = append(paths, shared)
+	} else if runtime.GOOS == "windows" {
+		paths = append(paths, "C:\\ProgramData\\nomads\\nomads.json", "C:\\ProgramData\\nomads\\nomads.toml")
+	} else {
+		paths = append(paths, "/etc/nomads/nomads.json", "/etc/nomads/nomads.toml")
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "nomads", "nomads.json"), filepath.Join(dir, "nomads", "nomads.toml"))
+	}
+	return paths
+}
+
+func loadConfigs() error {
+	for _, fn := range configPaths() {
+		if _, err := os.Stat(fn); err != nil {
+			continue
+		}
+		if err := loadConfig(fn); err != nil {
+			return err
+		}
+	}
+	if configFile != "" {
+		if err := loadConfig(configFile); err != nil {
+			return err
+		}
+	}
+	return checkConfig()
+}
+
+func loadConfig(fn string) error {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	where := func(offset int64) (int, int) { return lineCol(data, offset) }
+	if strings.EqualFold(filepath.Ext(fn), ".toml") {
+		t, err := readTOML(data)
+		if err != nil {
+			return fmt.Errorf("%s:%v", fn, err)
+		}
+		data, where = t.json()
+	}
+	var doc configDoc
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return configError(fn, data, where, err)
+	}
+	if dec.More() {
+		line, col := where(dec.InputOffset())
+		return fmt.Errorf("%s:%d:%d: unexpected data after top-level object", fn, line, col)
+	}
+	if verbose {
+		log.Printf("Config %s: %d zones %d models\n", fn, len(doc.Zones), len(doc.Models))
+	}
+
+	for id, mc := range doc.Models {
+		m := models[id]
+		mc.apply(&m)
+		models[id] = m
+		configModels[id] = true
+	}
+	for id, zc := range doc.Zones {
+		z := zones[id]
+		zc.apply(&z)
+		zones[id] = z
+		configZones[id] = true
+	}
+	return nil
+}
+
+func (zc zoneConfig) apply(z *Zone) {
+	if zc.Description != nil {
+		z.description = *zc.Description
+	}
+	if zc.Geo != nil {
+		z.geo = *zc.Geo
+	}
+	if zc.Model != nil {
+		z.model = *zc.Model
+	}
+	if zc.Longitude != nil {
+		z.longitude = Longitude{zc.Longitude[0], zc.Longitude[1]}
+	}
+	if zc.Latitude != nil {
+		z.latitude = Latitude{zc.Latitude[0], zc.Latitude[1]}
+	}
+	if zc.ModelLevels != nil {
+		z.modelLevels = *zc.ModelLevels
+	}
+	if zc.ModelVars != nil {
+		z.modelVars = *zc.ModelVars
+	}
+	if zc.RequireAllFields != nil {
+		z.requireAllFields = *zc.RequireAllFields
+	}
+	if zc.EarthWinds != nil {
+		z.earthWinds = *zc.EarthWinds
+	}
+	if zc.DeriveWinds != nil {
+		z.deriveWinds = *zc.DeriveWinds
+	}
+	if zc.GustFactor != nil {
+		z.gustFactor = *zc.GustFactor
+	}
+	if zc.Storm != nil {
+		z.storm = *zc.Storm
+	}
+	if zc.StormBox != nil {
+		z.stormBox = *zc.StormBox
+	}
+	if zc.Members != nil {
+		z.members = *zc.Members
+	}
+	if zc.PerMember != nil {
+		z.perMember = *zc.PerMember
+	}
+	if zc.EnsembleStats != nil {
+		z.ensembleStats = *zc.EnsembleStats
+	}
+	if zc.Thresholds != nil {
+		z.thresholds = *zc.Thresholds
+	}
+	if zc.Blend != nil {
+		z.blend = *zc.Blend
+	}
+	if zc.Points != nil {
+		z.points = nil
+		for _, p := range *zc.Points {
+			z.points = append(z.points, Point{p.Name, p.Lat, p.Lon})
+		}
+	}
+	if zc.Regrid != nil {
+		z.regrid = Regrid{zc.Regrid.Spacing, strings.ToLower(zc.Regrid.Method)}
+	}
+}
+
+func (mc modelConfig) apply(m *Model) {
+	if mc.Fn != nil {
+		m.fn = *mc.Fn
+	}
+	if mc.ModelFrequency != nil {
+		m.modelFrequency = *mc.ModelFrequency
+	}
+	if mc.ForecastFrequency != nil {
+		m.forecastFrequency = *mc.ForecastFrequency
+	}
+	if mc.Horizon != nil {
+		m.horizon = *mc.Horizon
+	}
+	if mc.Start != nil {
+		m.start = *mc.Start
+	}
+	if mc.End != nil {
+		m.end = *mc.End
+	}
+	if mc.Baseurl != nil {
+		m.baseurl = *mc.Baseurl
+	}
+	if mc.Baseurlfn != nil {
+		m.baseurlfn = *mc.Baseurlfn
+	}
+	if mc.Mirrorurl != nil {
+		m.mirrorurl = *mc.Mirrorurl
+	}
+	if mc.Source != nil {
+		m.source = *mc.Source
+	}
+	if mc.Probeurl != nil {
+		m.probeurl = *mc.Probeurl
+	}
+	if mc.Steps != nil {
+		m.steps = nil
+		for _, st := range *mc.Steps {
+			m.steps = append(m.steps, Step{st.From, st.To, st.Step})
+		}
+	}
+	if mc.Horizons != nil {
+		m.horizons = *mc.Horizons
+	}
+	if mc.Stormurl != nil {
+		m.stormurl = *mc.Stormurl
+	}
+}
+
+// Sanity check zones & models from config files so a typo is reported up
+// front instead of as a failed fetch.
+func checkConfig() error {
+	for id := range configModels {
+		m := models[id]
+		for _, d := range []string{m.modelFrequency, m.forecastFrequency, m.horizon, m.start, m.end} {
+			if _, err := time.ParseDuration(d); err != nil {
+				return fmt.Errorf("model %s: %v", id, err)
+			}
+		}
+		for _, st := range m.steps {
+			for _, d := range []string{st.from, st.to, st.step} {
+				if _, err := time.ParseDuration(d); err != nil {
+					return fmt.Errorf("model %s: step: %v", id, err)
+				}
+			}
+			if step, _ := time.ParseDuration(st.step); step <= 0 {
+				return fmt.Errorf("model %s: step %s isn't positive", id, st.step)
+			}
+		}
+		for hour, h := range m.horizons {
+			if hour < 0 || hour > 23 {
+				return fmt.Errorf("model %s: no cycle hour %d", id, hour)
+			}
+			if _, err := time.ParseDuration(h); err != nil {
+				return fmt.Errorf("model %s: horizon for %02dz: %v", id, hour, err)
+			}
+		}
+		if m.baseurl == "" || m.baseurlfn == "" {
+			return fmt.Errorf("model %s: baseurl and baseurlfn are required", id)
+		}
+		if err := checkUrlTemplates(m); err != nil {
+			return fmt.Errorf("model %s: %v", id, err)
+		}
+		if m.source != "" && m.source != "nomads" && m.source != "mirror" {
+			return fmt.Errorf("model %s: unknown source '%s'", id, m.source)
+		}
+		if m.source == "mirror" && m.mirrorurl == "" {
+			return fmt.Errorf("model %s: source is mirror but there's no mirrorurl", id)
+		}
+	}
+	for id := range configZones {
+		z := zones[id]
+		for _, p := range z.points {
+			if p.name == "" || math.Abs(p.lat) > 90 {
+				return fmt.Errorf("zone %s: bad point '%s' %g,%g", id, p.name, p.lat, p.lon)
+			}
+		}
+		if len(z.blend) > 0 {
+			if err := checkBlend(id, z); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := models[z.model]; !ok {
+			return fmt.Errorf("zone %s: unknown model '%s'", id, z.model)
+		}
+		if len(z.modelLevels) == 0 || len(z.modelVars) == 0 {
+			return fmt.Errorf("zone %s: modelLevels and modelVars are required", id)
+		}
+		if err := checkRegrid(z.regrid); err != nil {
+			return fmt.Errorf("zone %s: %v", id, err)
+		}
+		if (z.storm != "" || z.stormBox != 0) && models[z.model].stormurl == "" {
+			return fmt.Errorf("zone %s: model %s isn't run per storm", id, z.model)
+		}
+		if z.stormBox < 0 {
+			return fmt.Errorf("zone %s: negative stormBox", id)
+		}
+		if _, err := expandMembers(z.members); err != nil {
+			return fmt.Errorf("zone %s: %v", id, err)
+		}
+		if z.ensembleStats && len(z.members) == 0 {
+			return fmt.Errorf("zone %s: ensembleStats needs members", id)
+		}
+		for _, kt := range z.thresholds {
+			if kt <= 0 {
+				return fmt.Errorf("zone %s: bad threshold %g", id, kt)
+			}
+		}
+	}
+	return nil
+}
+
+// Turn a JSON decode error into file:line:col form. where gives the line
+// and column of an offset in data, which for a TOML file is its JSON.
+func configError(fn string, data []byte, where func(int64) (int, int), err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, col := where(syntaxErr.Offset)
+		return fmt.Errorf("%s:%d:%d: %v", fn, line, col, err)
+	case errors.As(err, &typeErr):
+		line, col := where(typeErr.Offset)
+		return fmt.Errorf("%s:%d:%d: %s: expected %v, got %s", fn, line, col, typeErr.Field, typeErr.Type, typeErr.Value)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		line, col := where(int64(len(data)))
+		return fmt.Errorf("%s:%d:%d: unexpected end of file", fn, line, col)
+	}
+
+	// encoding/json doesn't report where an unknown key is, so find it
+	var key string
+	if _, scanErr := fmt.Sscanf(err.Error(), "json: unknown field %q", &key); scanErr == nil {
+		if offset, ok := unknownKeyOffset(data, key); ok {
+			line, col := where(offset)
+			return fmt.Errorf("%s:%d:%d: unknown key %q", fn, line, col, key)
+		}
+	}
+	return fmt.Errorf("%s: %v", fn, err)
+}
+
+// Where key appears as a key of an object that has no such field. The
+// tokens are walked alongside configDoc's types, so the same name as a good
+// key elsewhere, or as a string value, isn't mistaken for it.
+func unknownKeyOffset(data []byte, key string) (int64, bool) {
+	type frame struct {
+		t      reflect.Type // The object or array's type, nil if not known
+		object bool
+		key    bool // The next token in the object is a key
+	}
+	var stack []frame
+	next := reflect.TypeOf(configDoc{}) // The next value's type
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, false
+		}
+		name, isString := tok.(string)
+		if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].key && isString {
+			stack[n-1].key = false
+			t, ok := memberType(stack[n-1].t, name)
+			if !ok && name == key {
+				// The offset is the end of the previous token
+				for offset < int64(len(data)) && data[offset] != '"' {
+					offset++
+				}
+				return offset, true
+			}
+			next = t
+			continue
+		}
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, frame{t: next, object: true})
+		case json.Delim('['):
+			stack = append(stack, frame{t: next})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		}
+		// A key or another element follows
+		if n := len(stack); n > 0 {
+			if stack[n-1].object {
+				stack[n-1].key = true
+			} else {
+				next = elemType(stack[n-1].t)
+			}
+		}
+	}
+}
+
+// The type of an object's member, false if a struct has no such field.
+// Like encoding/json, field names match case-insensitively.
+func memberType(t reflect.Type, name string) (reflect.Type, bool) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == nil:
+		return nil, true
+	case t.Kind() == reflect.Map:
+		return t.Elem(), true
+	case t.Kind() != reflect.Struct:
+		return nil, true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if strings.EqualFold(tag, name) {
+			return t.Field(i).Type, true
+		}
+	}
+	return nil, false
+}
+
+// The type of an array's elements
+func elemType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		return t.Elem()
+	}
+	return nil
+}
+
+func lineCol(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line = 1 + bytes.Count(data[:offset], []byte("\n"))
+	col = int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return line, col
+}
@@ -0,0 +1,193 @@
+package main
+
+import "os"
+import "path/filepath"
+import "strings"
+import "testing"
+
+// Write a config file to a temp dir and load it, restoring the built-in
+// zones & models when the test finishes
+func loadTestConfig(t *testing.T, config string) error {
+	t.Helper()
+	return loadTestConfigFile(t, "nomads.json", config)
+}
+
+func loadTestConfigFile(t *testing.T, name, config string) error {
+	t.Helper()
+	saveZones, saveModels := zones, models
+	zones, models = map[string]Zone{}, map[string]Model{}
+	for id, z := range saveZones {
+		zones[id] = z
+	}
+	for id, m := range saveModels {
+		models[id] = m
+	}
+	configZones, configModels = map[string]bool{}, map[string]bool{}
+	t.Cleanup(func() {
+		zones, models = saveZones, saveModels
+		configZones, configModels = map[string]bool{}, map[string]bool{}
+	})
+
+	fn := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fn, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(fn); err != nil {
+		return err
+	}
+	return checkConfig()
+}
+
+func TestLoadConfig(t *testing.T) {
+	config := `{
+  "zones": {
+    "rbyc": {
+      "description": "Richardson Bay (18 hour hrrr)",
+      "geo":         "rbyc",
+      "model":       "hrrr",
+      "longitude":   [-122.6, -122.3],
+      "latitude":    [38.0, 37.8],
+      "modelLevels": ["10_m_above_ground"],
+      "modelVars":   ["UGRD", "VGRD", "GUST"]
+    },
+    "sf": { "geo": "sfbay" }
+  },
+  "models": {
+    "hrrr": {
+      "end":      "95m",
+      "steps":    [{"from": "0h", "to": "12h", "step": "1h"}, {"from": "15h", "to": "48h", "step": "3h"}],
+      "horizons": {"3": "24h"}
+    }
+  }
+}`
+	hrrr, sf := models["hrrr"], zones["sf"]
+	if err := loadTestConfig(t, config); err != nil {
+		t.Fatal(err)
+	}
+
+	z := zones["rbyc"]
+	if z.model != "hrrr" || z.longitude != (Longitude{-122.6, -122.3}) || z.latitude != (Latitude{38.0, 37.8}) || len(z.modelVars) != 3 {
+		t.Errorf("rbyc = %+v", z)
+	}
+	// Only the keys in the file change
+	if z := zones["sf"]; z.geo != "sfbay" || z.description != sf.description || len(z.modelVars) != len(sf.modelVars) {
+		t.Errorf("sf = %+v", z)
+	}
+	if m := models["hrrr"]; m.end != "95m" || m.start != hrrr.start || m.baseurl != hrrr.baseurl || len(m.steps) != 2 || m.steps[1] != (Step{"15h", "48h", "3h"}) || m.horizons[3] != "24h" {
+		t.Errorf("hrrr = %+v", m)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"syntax", "{\n  \"zones\": {\n    \"x\": { \"geo\": \"x\",, }\n  }\n}", ":3:"},
+		{"unknown key", "{\n  \"zones\": {\n    \"x\": {\n      \"goe\": \"x\"\n    }\n  }\n}", `:4:7: unknown key "goe"`},
+		{"key elsewhere", "{\n  \"zones\": { \"x\": { \"model\": \"hrrr\", \"geo\": \"model\" } },\n  \"models\": {\n    \"hrrr\": { \"model\": \"x\" }\n  }\n}", `:4:15: unknown key "model"`},
+		{"type", "{\n  \"zones\": {\n    \"x\": { \"longitude\": \"-122\" }\n  }\n}", ":3:"},
+		{"truncated", "{\n  \"zones\": {\n", "unexpected end of file"},
+		{"trailing", "{}\n{}", ":2:1: unexpected data"},
+		{"model", `{"zones": {"x": {"model": "nope", "modelLevels": ["surface"], "modelVars": ["TMP"]}}}`, "unknown model 'nope'"},
+		{"levels", `{"zones": {"x": {"model": "hrrr"}}}`, "modelLevels and modelVars are required"},
+		{"duration", `{"models": {"hrrr": {"end": "95"}}}`, "model hrrr:"},
+		{"step", `{"models": {"hrrr": {"steps": [{"from": "0h", "to": "18h", "step": "0h"}]}}}`, "step 0h isn't positive"},
+		{"cycle", `{"models": {"hrrr": {"horizons": {"24": "48h"}}}}`, "no cycle hour 24"},
+		{"urls", `{"models": {"new": {"fn": "new", "modelFrequency": "6h", "forecastFrequency": "1h", "horizon": "6h", "start": "1h", "end": "2h"}}}`, "baseurl and baseurlfn are required"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := loadTestConfig(t, tc.config)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadTOMLConfig(t *testing.T) {
+	config := `# The same as TestLoadConfig's
+[zones.rbyc]
+description = "Richardson Bay (18 hour hrrr)"
+geo         = 'rbyc'
+model       = "hrrr"
+longitude   = [-122.6, -122.3]
+latitude    = [38.0, 37.8]
+modelLevels = ["10_m_above_ground"]
+modelVars   = [
+  "UGRD",
+  "VGRD",
+  "GUST", # Trailing comma
+]
+
+[zones]
+sf.geo = "sfbay"
+
+[models.hrrr]
+end = "95m"
+horizons = { 3 = "24h" }
+
+[[models.hrrr.steps]]
+from = "0h"
+to = "12h"
+step = "1h"
+
+[[models.hrrr.steps]]
+from = "15h"
+to = "48h"
+step = "3h"
+
+[models."gfs"]
+horizon = "38\u0034h"
+`
+	hrrr, sf := models["hrrr"], zones["sf"]
+	if err := loadTestConfigFile(t, "nomads.toml", config); err != nil {
+		t.Fatal(err)
+	}
+
+	z := zones["rbyc"]
+	if z.geo != "rbyc" || z.model != "hrrr" || z.longitude != (Longitude{-122.6, -122.3}) || z.latitude != (Latitude{38.0, 37.8}) || len(z.modelVars) != 3 {
+		t.Errorf("rbyc = %+v", z)
+	}
+	if z := zones["sf"]; z.geo != "sfbay" || z.description != sf.description || len(z.modelVars) != len(sf.modelVars) {
+		t.Errorf("sf = %+v", z)
+	}
+	if m := models["hrrr"]; m.end != "95m" || m.start != hrrr.start || len(m.steps) != 2 || m.steps[1] != (Step{"15h", "48h", "3h"}) || m.horizons[3] != "24h" {
+		t.Errorf("hrrr = %+v", m)
+	}
+	if m := models["gfs"]; m.horizon != "384h" {
+		t.Errorf("gfs horizon %s", m.horizon)
+	}
+}
+
+func TestTOMLConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"unknown key", "[zones.x]\ngeo = \"x\"\n  goe = \"x\"\n", `:3:3: unknown key "goe"`},
+		{"key elsewhere", "[zones.x]\nmodel = \"hrrr\"\n\n[models.hrrr]\nend = \"95m\"\nmodel = \"x\"\n", `:6:1: unknown key "model"`},
+		{"type", "[zones.x]\nlongitude = \"-122\"\n", ":2:13: zones.x.longitude: expected [2]float64, got string"},
+		{"array type", "[zones.x]\ngeo = [\"x\"]\n", ":2:7:"},
+		{"duplicate key", "[zones.x]\ngeo = \"x\"\ngeo = \"y\"\n", `:3:1: key "geo" is already defined`},
+		{"duplicate table", "[zones.x]\n[zones.x]\n", `:2:8: table "x" is already defined`},
+		{"inline table", "[models]\nhrrr = { end = \"95m\" }\nhrrr.start = \"1h\"\n", `:3:1: inline table "hrrr" can't be extended`},
+		{"string", "[zones.x]\ngeo = \"x\n", ":2:9: unterminated string"},
+		{"multi-line", "[zones.x]\ngeo = \"\"\"x\"\"\"\n", "multi-line strings aren't supported"},
+		{"value", "[zones.x]\ngeo = x\n", `:2:7: invalid value "x"`},
+		{"end of line", "[zones.x] geo = \"x\"\n", ":1:11: expected the end of the line"},
+		{"array", "[zones.x]\nmodelVars = [\"TMP\" \"RH\"]\n", ":2:20: expected ',' or ']'"},
+		{"checked", "[models.hrrr]\nsteps = [{ from = \"0h\", to = \"18h\", step = \"0h\" }]\n", "step 0h isn't positive"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := loadTestConfigFile(t, "nomads.toml", tc.config)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import "os"
+import "bytes"
+import "fmt"
+import "log"
+import "math"
+import "path/filepath"
+
+// Crop GRIB2 fields to a zone's bounding box, the way the NOMADS filter
+// scripts' subregion option does, so full-domain downloads from the mirrors
+// end up the same as filtered ones. The result is the smallest rectangle of
+// grid points that covers the box; for Lambert grids that's a rectangle in
+// the projection, so it reaches a little past the box at the corners.
+
+// Grid index range covering the box
+func cropBounds(g *gribGrid, lon Longitude, lat Latitude) (i0, i1, j0, j1 int, err error) {
+	width := lon.east - lon.west
+	if width <= 0 {
+		width += 360
+	}
+	const eps = 1e-6
+	var imin, imax, jmin, jmax float64
+
+	if g.template == 0 {
+		xw, jn := g.index(lat.north, lon.west)
+		_, js := g.index(lat.south, lon.west)
+		imin, imax = xw, xw+width/g.di
+		jmin, jmax = math.Min(jn, js), math.Max(jn, js)
+	} else {
+		// Parallels are curved in the projection so check along the edges
+		imin, jmin = math.Inf(1), math.Inf(1)
+		imax, jmax = math.Inf(-1), math.Inf(-1)
+		const steps = 50
+		for k := 0; k <= steps; k++ {
+			t := float64(k) / steps
+			la := lat.north - t*(lat.north-lat.south)
+			lo := lon.west + t*width
+			for _, p := range [][2]float64{{lat.north, lo}, {lat.south, lo}, {la, lon.west}, {la, lon.west + width}} {
+				i, j := g.index(p[0], p[1])
+				imin, imax = math.Min(imin, i), math.Max(imax, i)
+				jmin, jmax = math.Min(jmin, j), math.Max(jmax, j)
+			}
+		}
+	}
+
+	i0, i1 = int(math.Floor(imin+eps)), int(math.Ceil(imax-eps))
+	j0, j1 = int(math.Floor(jmin+eps)), int(math.Ceil(jmax-eps))
+	if g.global() {
+		if i1-i0+1 > g.nx {
+			i1 = i0 + g.nx - 1
+		}
+	} else {
+		i0, i1 = max(i0, 0), min(i1, g.nx-1)
+	}
+	j0, j1 = max(j0, 0), min(j1, g.ny-1)
+	if i0 > i1 || j0 > j1 {
+		return 0, 0, 0, 0, fmt.Errorf("zone is outside the %dx%d grid", g.nx, g.ny)
+	}
+	return i0, i1, j0, j1, nil
+}
+
+// The grid made of points i0-i1, j0-j1 of g
+func (g *gribGrid) subgrid(i0, i1, j0, j1 int) *gribGrid {
+	sub := *g
+	sub.nx, sub.ny = i1-i0+1, j1-j0+1
+	sub.la1, sub.lo1 = g.latLon(float64(i0), float64(j0))
+	if g.template == 30 {
+		sub.lambertSetup()
+	} else {
+		sub.la2, sub.lo2 = g.latLon(float64(i1), float64(j1))
+	}
+	return &sub
+}
+
+func cropValues(g *gribGrid, vals []float64, i0, i1, j0, j1 int) []float64 {
+	cropped := make([]float64, 0, (i1-i0+1)*(j1-j0+1))
+	for j := j0; j <= j1; j++ {
+		for i := i0; i <= i1; i++ {
+			cropped = append(cropped, vals[j*g.nx+(i%g.nx+g.nx)%g.nx])
+		}
+	}
+	return cropped
+}
+
+// Crop one field, returning it as a message on its own
+func cropField(f *grib2Field, lon Longitude, lat Latitude) ([]byte, error) {
+	g, err := f.grid()
+	if err != nil {
+		return nil, err
+	}
+	if !f.unpackable() {
+		return nil, fmt.Errorf("data template 5.%d not supported", f.dataTemplate)
+	}
+	i0, i1, j0, j1, err := cropBounds(g, lon, lat)
+	if err != nil {
+		return nil, err
+	}
+	if i0 == 0 && j0 == 0 && i1 == g.nx-1 && j1 == g.ny-1 {
+		return f.message(), nil
+	}
+	vals, err := f.values()
+	if err != nil {
+		return nil, err
+	}
+	sub := g.subgrid(i0, i1, j0, j1)
+	return f.repack(sub.section(), f.sec[4], cropValues(g, vals, i0, i1, j0, j1)), nil
+}
+
+// Crop every field in a GRIB file in place. Fields that can't be cropped
+// (unsupported grid or packing) are kept whole with a warning.
+func cropFile(fn string, lon Longitude, lat Latitude) error {
+	msgs, err := readGrib2File(fn)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	for _, f := range gribFields(msgs) {
+		msg, err := cropField(f, lon, lat)
+		if err != nil {
+			log.Printf("%s: can't crop %s: %v\n", filepath.Base(fn), f, err)
+			msg = f.message()
+		}
+		out.Write(msg)
+	}
+	return replaceFile(fn, out.Bytes())
+}
+
+// Write data to a temp file beside fn and rename it into place
+func replaceFile(fn string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fn), filepath.Base(fn)+".*.part")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fn)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package main
+
+import "math"
+import "testing"
+
+func TestCropLatLon(t *testing.T) {
+	// 9x9 at 0.5 degrees from 40N 130W, each value i + 10j
+	g := testLatLonGrid(9, 9, 40, 230, 0.5)
+	vals := make([]float64, g.nx*g.ny)
+	for j := 0; j < g.ny; j++ {
+		for i := 0; i < g.nx; i++ {
+			vals[j*g.nx+i] = float64(i + 10*j)
+		}
+	}
+	f := parseTestField(t, testMessage(g, 2, 2, 6, 0, vals))
+
+	msg, err := cropField(f, Longitude{-129, -128}, Latitude{39, 38})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cropped := parseTestField(t, msg)
+	cg, err := cropped.grid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cg.nx != 3 || cg.ny != 3 || cg.la1 != 39 || cg.lo1 != 231 || cg.la2 != 38 || cg.lo2 != 232 {
+		t.Errorf("cropped to %dx%d %g,%g to %g,%g", cg.nx, cg.ny, cg.la1, cg.lo1, cg.la2, cg.lo2)
+	}
+	got, err := cropped.values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, got, []float64{22, 23, 24, 32, 33, 34, 42, 43, 44}, 0)
+
+	// A box covering the grid leaves the message alone
+	msg, err = cropField(f, Longitude{-131, -125}, Latitude{41, 35})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != string(f.msg.raw) {
+		t.Error("whole grid was repacked")
+	}
+
+	if _, err := cropField(f, Longitude{-100, -99}, Latitude{39, 38}); err == nil {
+		t.Error("box off the grid cropped")
+	}
+}
+
+// An HRRR-like Lambert conformal grid: the crop keeps the projection and
+// its first point is the old grid's point at the crop's corner
+func TestCropLambert(t *testing.T) {
+	g := &gribGrid{template: 30, nx: 200, ny: 150, resFlags: 0x08, earth: make([]byte, 16),
+		la1: 21.138123, lo1: 237.280472, lad: 38.5, lov: 262.5, dx: 3000, dy: 3000,
+		latin1: 38.5, latin2: 38.5, scan: 0x40, pole: make([]byte, 8)}
+	g.earth[0] = 6
+	g.radius = earthRadius(g.earth)
+	g.lambertSetup()
+	vals := make([]float64, g.nx*g.ny)
+	for k := range vals {
+		vals[k] = float64(k % 1000)
+	}
+	f := parseTestField(t, testMessage(g, 0, 0, 6, 0, vals))
+
+	lon, lat := Longitude{-122, -121}, Latitude{23, 22}
+	i0, i1, j0, j1, err := cropBounds(g, lon, lat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := cropField(f, lon, lat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cropped := parseTestField(t, msg)
+	cg, err := cropped.grid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cg.nx != i1-i0+1 || cg.ny != j1-j0+1 || cg.lov != g.lov || cg.latin1 != g.latin1 || cg.resFlags != g.resFlags {
+		t.Errorf("cropped grid %+v", cg)
+	}
+	la, lo := g.latLon(float64(i0), float64(j0))
+	if math.Abs(cg.la1-la) > 1e-5 || math.Abs(cg.lo1-lo) > 1e-5 {
+		t.Errorf("first point %g,%g, want %g,%g", cg.la1, cg.lo1, la, lo)
+	}
+	for _, p := range [][2]float64{{23, -122}, {23, -121}, {22, -122}, {22, -121}} {
+		i, j := cg.index(p[0], p[1])
+		if i < -1e-6 || j < -1e-6 || i > float64(cg.nx-1)+1e-6 || j > float64(cg.ny-1)+1e-6 {
+			t.Errorf("%g,%g is at %.2f,%.2f outside the %dx%d crop", p[0], p[1], i, j, cg.nx, cg.ny)
+		}
+	}
+	got, err := cropped.values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, got, cropValues(g, vals, i0, i1, j0, j1), 0)
+}
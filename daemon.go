@@ -0,0 +1,110 @@
+package main
+
+import "context"
+import "log"
+import "time"
+
+// -daemon keeps a set of regions up to date. Each region waits for its
+// model's next run to start posting (the run time plus the model's start
+// lag, or the learned one with -learned-lags), then polls with -merge
+// semantics until every forecast is in or the run after it should be
+// complete, and moves on to the following run.
+
+var daemon bool
+var pollInterval time.Duration
+
+type daemonRegion struct {
+	id  string
+	run time.Time // Model run to fetch next
+	due time.Time // When to look for it
+}
+
+func runDaemon(ctx context.Context, ids []string) error {
+	now := time.Now().UTC()
+	var regions []*daemonRegion
+	for _, id := range ids {
+		if err := useZone(id); err != nil {
+			return err
+		}
+		// Start with the run that's posting now, or the last one to have started
+		run, _, _ := latestRun(now, 0, true)
+		regions = append(regions, &daemonRegion{id: id, run: run, due: now})
+		log.Printf("Daemon: %s (%s) from the %s run\n", id, Z.model, run.Format("2006-01-02 15z"))
+	}
+
+	// The daemon decides what to fetch, not the flags
+	prev = 0
+	merge = true
+	refetch = false
+
+	for {
+		next := regions[0]
+		for _, r := range regions[1:] {
+			if r.due.Before(next.due) {
+				next = r
+			}
+		}
+		if wait := time.Until(next.due); wait > 0 {
+			local := next.due.Local()
+			log.Printf("Daemon: waiting until %02d:%02d for %s %02dz\n", local.Hour(), local.Minute(), next.id, next.run.Hour())
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		daemonFetch(ctx, next)
+	}
+}
+
+// Fetch what's posted of r's run and work out when to look again
+func daemonFetch(ctx context.Context, r *daemonRegion) {
+	if err := useZone(r.id); err != nil {
+		log.Printf("Daemon: %v\n", err)
+		r.due = time.Now().Add(pollInterval)
+		return
+	}
+	startLag, endLag := modelLags(r.run)
+	modelFrequency, _ := time.ParseDuration(M.modelFrequency)
+
+	now := time.Now().UTC()
+	zulu = r.run
+	forecastLast := r.run.Add(endLag)
+	inProgress = now.Before(forecastLast)
+	log.Printf("Daemon: fetching %s %s run\n", r.id, r.run.Format("2006-01-02 15z"))
+
+	complete := false
+	var summary fetchSummary
+	err := selectStorm(ctx)
+	if err == nil {
+		summary, err = fetchRun(ctx, forecastLast)
+	}
+	switch {
+	case err == errRunExists:
+		complete = true
+	case err != nil:
+		log.Printf("Daemon: %s: %v\n", r.id, err)
+	case summary.bad == 0 && summary.good+summary.skipped > 0:
+		complete = true
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Give up on forecasts that still aren't there once the next run should be done
+	if !complete && now.After(forecastLast.Add(modelFrequency)) {
+		log.Printf("Daemon: giving up on %s %02dz with %d forecasts missing\n", r.id, r.run.Hour(), summary.bad)
+		complete = true
+	}
+
+	if complete {
+		r.run = r.run.Add(modelFrequency)
+		startLag, _ = modelLags(r.run)
+		r.due = r.run.Add(startLag)
+		return
+	}
+	r.due = time.Now().Add(pollInterval)
+}
@@ -0,0 +1,180 @@
+package main
+
+import "log"
+import "math"
+import "time"
+
+// HRRR gives WIND but GFS and the NAM only U and V, so apps show different
+// variables per model. With deriveWinds every U/V pair in a forecast gets
+// a wind speed (WIND) and meteorological direction (WDIR, degrees the wind
+// is from, earth-relative) alongside it, and with gustFactor too each GUST
+// a gust factor - gust over the 10 m wind speed. WIND is packed like the U
+// it came from, WDIR to the degree and the gust factor to 0.01. Fields the
+// model already has aren't derived again.
+//
+// WMO has no gust factor parameter, so it's local number 250 in category 2
+// (GUSTF in gribParams). That's read against the originating centre's local
+// table: NCEP's version 1 table for category 2 stops short of 250, and
+// the gust factor messages say version 1 in section 1 whatever the model
+// said, so a reader with a later NCEP table can tell. A reader that doesn't
+// know the number shows it as a local parameter, which is why it's only
+// written when asked for.
+
+var deriveWinds, gustFactor bool
+
+const gustFactorParameter = 250
+
+// The version of NCEP's local tables gustFactorParameter is unassigned in
+const gustFactorLocalTables = 1
+
+// No gust factor in calms
+const gustFactorMinWind = 1.0 // m/s
+
+// Section 5 for simple packing with a decimal scale factor, for packValues
+func simplePacking(decimal int) []byte {
+	tmpl := make([]byte, 16)
+	putGribInt16(tmpl[12:], decimal)
+	return gribSection(5, tmpl)
+}
+
+// A new field on f's grid with another identification, product definition,
+// packing and values
+func derivedField(f *grib2Field, sec1, sec4, sec5 []byte, vals []float64) (*grib2Field, error) {
+	sec5, sec6, sec7 := packValues(sec5, vals)
+	sections := [][]byte{sec1}
+	if f.sec[2] != nil {
+		sections = append(sections, f.sec[2])
+	}
+	sections = append(sections, f.sec[3], sec4, sec5, sec6, sec7)
+	m, err := parseGrib2Message(gribMessage(f.msg.discipline, sections...), 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.fields[0], nil
+}
+
+// f's identification labelled with a version of the local tables
+func withLocalTables(f *grib2Field, version int) []byte {
+	sec1 := append([]byte{}, f.sec[1]...)
+	sec1[10] = byte(version)
+	return sec1
+}
+
+// f's product definition for another category 2 parameter
+func withParameter(f *grib2Field, parameter int) []byte {
+	sec4 := append([]byte{}, f.sec[4]...)
+	sec4[10] = byte(parameter)
+	return sec4
+}
+
+// Same time, level and member whatever the parameter. Unlike vectorKey the
+// grid isn't part of it: rotated winds are flagged earth-relative.
+func derivedKey(f *grib2Field) string {
+	sec4 := append([]byte{}, f.sec[4]...)
+	sec4[10] = 0
+	return string(sec4)
+}
+
+// The wind speed and direction fields for a forecast's fields, and with
+// gust the gust factor
+func derivedWinds(fields []*grib2Field, gust bool) []*grib2Field {
+	type fieldId struct {
+		key       string
+		parameter int
+	}
+	have := map[fieldId]bool{}
+	vs := map[string]*grib2Field{}
+	winds := map[time.Time][]float64{} // 10 m speeds
+	for _, f := range fields {
+		if f.msg.discipline != 0 || f.category != 2 {
+			continue
+		}
+		switch f.parameter {
+		case 0, 1:
+			have[fieldId{derivedKey(f), f.parameter}] = true
+			if f.parameter == 1 && levelName(f.level1, f.level2) == "10_m_above_ground" {
+				if vals, err := f.values(); err == nil {
+					winds[f.validTime()] = vals
+				}
+			}
+		}
+	}
+
+	var out []*grib2Field
+	add := func(f *grib2Field, err error) {
+		if err != nil {
+			log.Printf("Can't derive winds: %v\n", err)
+			return
+		}
+		out = append(out, f)
+	}
+	earth := rotateWinds(fields)
+	for _, f := range earth {
+		if f.msg.discipline == 0 && f.category == 2 && f.parameter == 3 {
+			vs[derivedKey(f)] = f
+		}
+	}
+	for _, uf := range earth {
+		if uf.msg.discipline != 0 || uf.category != 2 || uf.parameter != 2 {
+			continue
+		}
+		key := derivedKey(uf)
+		vf, ok := vs[key]
+		if !ok || !uf.unpackable() || !vf.unpackable() {
+			continue
+		}
+		u, err := uf.values()
+		if err != nil {
+			add(nil, err)
+			continue
+		}
+		v, err := vf.values()
+		if err != nil {
+			add(nil, err)
+			continue
+		}
+		if len(v) != len(u) {
+			continue
+		}
+		speed := make([]float64, len(u))
+		dir := make([]float64, len(u))
+		for i := range u {
+			speed[i], dir[i] = vectorDirection(u[i], v[i], true)
+		}
+		if !have[fieldId{key, 1}] {
+			add(derivedField(uf, uf.sec[1], withParameter(uf, 1), uf.sec[5], speed))
+			if levelName(uf.level1, uf.level2) == "10_m_above_ground" {
+				winds[uf.validTime()] = speed
+			}
+		}
+		if !have[fieldId{key, 0}] {
+			add(derivedField(uf, uf.sec[1], withParameter(uf, 0), simplePacking(0), dir))
+		}
+	}
+
+	if !gust {
+		return out
+	}
+	for _, gf := range fields {
+		if gf.msg.discipline != 0 || gf.category != 2 || gf.parameter != 22 || !gf.unpackable() {
+			continue
+		}
+		wind, ok := winds[gf.validTime()]
+		if !ok {
+			continue
+		}
+		gust, err := gf.values()
+		if err != nil || len(gust) != len(wind) {
+			continue
+		}
+		factor := make([]float64, len(gust))
+		for i := range gust {
+			factor[i] = math.NaN()
+			if wind[i] >= gustFactorMinWind {
+				factor[i] = gust[i] / wind[i]
+			}
+		}
+		add(derivedField(gf, withLocalTables(gf, gustFactorLocalTables), withParameter(gf, gustFactorParameter), simplePacking(2), factor))
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package main
+
+import "math"
+import "testing"
+import "time"
+
+func TestDerivedWinds(t *testing.T) {
+	g := testLatLonGrid(2, 2, 38, 237, 0.5)
+	u := []float64{3, 0, -10, 0}
+	v := []float64{4, -10, 0, 0.5}
+	gust := []float64{10, 15, 20, 5}
+	var data []byte
+	data = append(data, testMessage(g, 2, 2, 6, 2, u)...)
+	data = append(data, testMessage(g, 2, 3, 6, 2, v)...)
+	data = append(data, testMessage(g, 2, 22, 6, 1, gust)...)
+	msgs, err := parseGrib2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := gribFields(msgs)
+
+	nan := math.NaN()
+	want := map[string][]float64{
+		"WIND":  {5, 10, 10, 0.5},
+		"WDIR":  {217, 0, 90, 180},
+		"GUSTF": {2, 1.5, 2, nan}, // Calm at the last point
+	}
+	derived := derivedWinds(fields, true)
+	if len(derived) != len(want) {
+		t.Fatalf("%d fields derived, want %d", len(derived), len(want))
+	}
+	for _, f := range derived {
+		vals, err := f.values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, ok := want[f.name()]
+		if !ok || f.forecast != 6*time.Hour || levelName(f.level1, f.level2) != "10_m_above_ground" {
+			t.Errorf("derived %s", f)
+			continue
+		}
+		checkValues(t, vals, w, 0.01)
+		// The gust factor says which NCEP local table it's from
+		if local := f.sec[1][10]; (f.name() == "GUSTF") != (local == gustFactorLocalTables) {
+			t.Errorf("%s: local tables version %d", f, local)
+		}
+	}
+	if derived := derivedWinds(fields, false); len(derived) != 2 || derived[0].name() != "WIND" || derived[1].name() != "WDIR" {
+		t.Errorf("without the gust factor derived %v", derived)
+	}
+
+	// The model's own wind speed isn't derived again, and the gust factor
+	// uses it
+	wind := []float64{4, 10, 10, 2}
+	data = append(data, testMessage(g, 2, 1, 6, 1, wind)...)
+	if msgs, err = parseGrib2(data); err != nil {
+		t.Fatal(err)
+	}
+	derived = derivedWinds(gribFields(msgs), true)
+	if len(derived) != 2 || derived[0].name() != "WDIR" || derived[1].name() != "GUSTF" {
+		t.Fatalf("derived %v", derived)
+	}
+	vals, err := derived[1].values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, vals, []float64{2.5, 1.5, 2, 2.5}, 0.01)
+}
@@ -0,0 +1,104 @@
+package main
+
+import "fmt"
+import "strconv"
+import "strings"
+
+// GEFS publishes each ensemble member as its own set of files - the control
+// gec00, perturbations gep01-gep30 - next to the mean (geavg) and spread
+// (gespr). A zone with members fetches each of them through the same worker
+// pool, then writes one composite holding every member, or one per member.
+// Fields in the combined file carry the ensemble product templates (4.1,
+// 4.11) so apps can tell the members apart.
+
+// Control plus perturbations
+const gefsMembers = 31
+
+// Expand a zone's member list: "all" is the control and every
+// perturbation, "gep01-gep10" a range.
+func expandMembers(list []string) ([]string, error) {
+	var members []string
+	for _, m := range list {
+		switch {
+		case m == "all":
+			members = append(members, "gec00")
+			for i := 1; i < gefsMembers; i++ {
+				members = append(members, fmt.Sprintf("gep%02d", i))
+			}
+		case strings.Contains(m, "-"):
+			from, to, _ := strings.Cut(m, "-")
+			if len(from) < 4 || len(to) < 4 || from[:3] != to[:3] {
+				return nil, fmt.Errorf("bad member range %s", m)
+			}
+			i, err1 := strconv.Atoi(from[3:])
+			j, err2 := strconv.Atoi(to[3:])
+			if err1 != nil || err2 != nil || j < i {
+				return nil, fmt.Errorf("bad member range %s", m)
+			}
+			for ; i <= j; i++ {
+				members = append(members, fmt.Sprintf("%s%02d", from[:3], i))
+			}
+		default:
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
+// Code table 4.6 type and perturbation number of a member. The mean and
+// spread aren't members.
+func memberInfo(member string) (typ, number int, ok bool) {
+	if len(member) < 4 {
+		return 0, 0, false
+	}
+	n, err := strconv.Atoi(member[3:])
+	if err != nil {
+		return 0, 0, false
+	}
+	switch member[:3] {
+	case "gec":
+		return 1, n, true // Low resolution control
+	case "gen":
+		return 2, n, true
+	case "gep":
+		return 3, n, true
+	}
+	return 0, 0, false
+}
+
+// The field with an individual ensemble product template: 4.0 becomes 4.1
+// and 4.8 (accumulations etc.) 4.11. Both insert the ensemble octets 35-37.
+func (f *grib2Field) ensembleMessage(typ, number, size int) []byte {
+	sec := f.sec[4]
+	if (f.productTemplate != 0 && f.productTemplate != 8) || gribInt16(sec[5:]) != 0 || len(sec) < 34 {
+		return f.message() // Already an ensemble template, or one we don't know
+	}
+	sec4 := make([]byte, 0, len(sec)+3)
+	sec4 = append(sec4, sec[:34]...)
+	sec4 = append(sec4, byte(typ), byte(number), byte(size))
+	sec4 = append(sec4, sec[34:]...)
+	putGribInt32(sec4, len(sec4))
+	template := 1
+	if f.productTemplate == 8 {
+		template = 11
+	}
+	putGribInt16(sec4[7:], template)
+	return f.withProduct(sec4)
+}
+
+// Give a member's messages the ensemble product templates
+func ensembleData(data []byte, member string) ([]byte, error) {
+	typ, number, ok := memberInfo(member)
+	if !ok {
+		return data, nil
+	}
+	msgs, err := parseGrib2(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, f := range gribFields(msgs) {
+		out = append(out, f.ensembleMessage(typ, number, gefsMembers)...)
+	}
+	return out, nil
+}
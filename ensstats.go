@@ -0,0 +1,315 @@
+package main
+
+import "fmt"
+import "log"
+import "math"
+import "os"
+import "path/filepath"
+import "strconv"
+import "strings"
+
+// Routing apps want more from an ensemble than 31 sets of winds. A zone
+// with ensembleStats writes a second file next to the composite with, at
+// each step,
+//
+//   WIND  ensemble mean (template 4.2, derived forecast 0)
+//   WIND  standard deviation about the mean (4.2, derived forecast 2)
+//   WIND  probability above each threshold (4.5, percent)
+//   GUST  probability above each threshold (4.5, percent), if fetched
+//
+// Wind speed is from the 10 m U and V, gust from the surface GUST. Fields
+// over an interval (4.11 members) become 4.12 and 4.9.
+
+var thresholdList string // -thresholds, knots
+
+// Knots unless the zone says otherwise
+var defaultThresholds = []float64{20, 25, 30}
+
+const metresPerSecondPerKnot = 1852.0 / 3600
+
+// Code table 4.7
+const (
+	derivedMean   = 0
+	derivedStdDev = 2
+)
+
+// Code table 4.9 - probability of the event above the upper limit
+const probabilityAbove = 1
+
+// The exceedance thresholds in knots: -thresholds, then the zone's, then
+// the default
+func exceedanceThresholds() ([]float64, error) {
+	if thresholdList == "" {
+		if len(Z.thresholds) > 0 {
+			return Z.thresholds, nil
+		}
+		return defaultThresholds, nil
+	}
+	return parseThresholds(thresholdList)
+}
+
+func parseThresholds(list string) ([]float64, error) {
+	var thresholds []float64
+	for _, s := range strings.Split(list, ",") {
+		kt, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || kt <= 0 {
+			return nil, fmt.Errorf("bad threshold '%s'", s)
+		}
+		thresholds = append(thresholds, kt)
+	}
+	return thresholds, nil
+}
+
+// One member's winds at a step
+type memberWinds struct {
+	u, v, gust *grib2Field
+}
+
+// The 10 m winds and surface gust in a member's forecast, after the same
+// post-processing as the composite
+func readMemberWinds(fn string) (memberWinds, error) {
+	var w memberWinds
+	data, err := compositeData(fn)
+	if err != nil {
+		return w, err
+	}
+	msgs, err := parseGrib2(data)
+	if err != nil {
+		return w, err
+	}
+	for _, f := range gribFields(msgs) {
+		if f.msg.discipline != 0 || f.category != 2 {
+			continue
+		}
+		level := levelName(f.level1, f.level2)
+		switch {
+		case f.parameter == 2 && level == "10_m_above_ground":
+			w.u = f
+		case f.parameter == 3 && level == "10_m_above_ground":
+			w.v = f
+		case f.parameter == 22 && level == "surface":
+			w.gust = f
+		}
+	}
+	if w.u == nil || w.v == nil {
+		return w, fmt.Errorf("no 10 m winds")
+	}
+	return w, nil
+}
+
+// A product definition for an ensemble statistic built from a member's:
+// the fixed part through the surfaces, then extra, then the member's time
+// interval if it has one. Templates 4.2 and 4.5 become 4.12 and 4.9 over
+// an interval.
+func statsProduct(f *grib2Field, template, parameter int, extra []byte) ([]byte, error) {
+	sec := f.sec[4]
+	var interval []byte
+	switch f.productTemplate {
+	case 0, 1:
+	case 8:
+		interval = sec[34:]
+	case 11:
+		interval = sec[37:]
+	default:
+		return nil, fmt.Errorf("template 4.%d not supported", f.productTemplate)
+	}
+	if gribInt16(sec[5:]) != 0 {
+		return nil, fmt.Errorf("template 4.%d with coordinate values not supported", f.productTemplate)
+	}
+	if interval != nil {
+		template = map[int]int{2: 12, 5: 9}[template]
+	}
+	sec4 := make([]byte, 0, 34+len(extra)+len(interval))
+	sec4 = append(sec4, sec[:34]...)
+	sec4 = append(sec4, extra...)
+	sec4 = append(sec4, interval...)
+	putGribInt32(sec4, len(sec4))
+	putGribInt16(sec4[7:], template)
+	sec4[10] = byte(parameter)
+	return sec4, nil
+}
+
+// Template 4.2/4.12 octets 35-36
+func derivedProduct(f *grib2Field, parameter, derived, size int) ([]byte, error) {
+	return statsProduct(f, 2, parameter, []byte{byte(derived), byte(size)})
+}
+
+// Template 4.5/4.9 octets 35-47: the nth of total probabilities, of the
+// value being above limit (m/s)
+func probabilityProduct(f *grib2Field, parameter, n, total int, limit float64) ([]byte, error) {
+	extra := make([]byte, 13)
+	extra[0] = byte(n)
+	extra[1] = byte(total)
+	extra[2] = probabilityAbove
+	extra[8] = 2 // Upper limit in hundredths
+	putGribInt32(extra[9:], int(math.Round(limit*100)))
+	return statsProduct(f, 5, parameter, extra)
+}
+
+// Percent of the members above the limit at each point
+func exceedance(fields [][]float64, limit float64) []float64 {
+	prob := make([]float64, len(fields[0]))
+	for i := range prob {
+		n, above := 0, 0
+		for _, vals := range fields {
+			if math.IsNaN(vals[i]) {
+				continue
+			}
+			n++
+			if vals[i] > limit {
+				above++
+			}
+		}
+		prob[i] = math.NaN()
+		if n > 0 {
+			prob[i] = 100 * float64(above) / float64(n)
+		}
+	}
+	return prob
+}
+
+// Mean and standard deviation about the mean at each point
+func meanStdDev(fields [][]float64) (mean, sd []float64) {
+	mean = make([]float64, len(fields[0]))
+	sd = make([]float64, len(fields[0]))
+	for i := range mean {
+		n, sum, sum2 := 0, 0.0, 0.0
+		for _, vals := range fields {
+			if !math.IsNaN(vals[i]) {
+				n++
+				sum += vals[i]
+			}
+		}
+		if n == 0 {
+			mean[i], sd[i] = math.NaN(), math.NaN()
+			continue
+		}
+		mean[i] = sum / float64(n)
+		for _, vals := range fields {
+			if !math.IsNaN(vals[i]) {
+				d := vals[i] - mean[i]
+				sum2 += d * d
+			}
+		}
+		sd[i] = math.Sqrt(sum2 / float64(n))
+	}
+	return mean, sd
+}
+
+// The statistics for one step from its members' forecast files
+func stepStatistics(files []string, thresholds []float64) ([]byte, error) {
+	var first *grib2Field
+	var speeds, gusts [][]float64
+	var gust *grib2Field
+	for _, fn := range files {
+		w, err := readMemberWinds(fn)
+		if err != nil {
+			log.Printf("%s: %v\n", filepath.Base(fn), err)
+			continue
+		}
+		if first != nil && string(w.u.sec[3]) != string(first.sec[3]) {
+			log.Printf("%s: grid differs from the other members\n", filepath.Base(fn))
+			continue
+		}
+		u, err := w.u.values()
+		if err != nil {
+			return nil, err
+		}
+		v, err := w.v.values()
+		if err != nil {
+			return nil, err
+		}
+		speed := make([]float64, len(u))
+		for i := range u {
+			speed[i] = math.Hypot(u[i], v[i]) // NaN if either is
+		}
+		if first == nil {
+			first = w.u
+		}
+		speeds = append(speeds, speed)
+
+		if w.gust != nil && string(w.gust.sec[3]) == string(first.sec[3]) {
+			g, err := w.gust.values()
+			if err != nil {
+				return nil, err
+			}
+			gust = w.gust
+			gusts = append(gusts, g)
+		}
+	}
+	if len(speeds) < 2 {
+		return nil, fmt.Errorf("%d members with winds", len(speeds))
+	}
+
+	var out []byte
+	mean, sd := meanStdDev(speeds)
+	for _, s := range []struct {
+		derived int
+		vals    []float64
+	}{{derivedMean, mean}, {derivedStdDev, sd}} {
+		sec4, err := derivedProduct(first, 1, s.derived, len(speeds))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, first.repack(first.sec[3], sec4, s.vals)...)
+	}
+	for n, kt := range thresholds {
+		limit := kt * metresPerSecondPerKnot
+		sec4, err := probabilityProduct(first, 1, n+1, len(thresholds), limit)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, first.repack(first.sec[3], sec4, exceedance(speeds, limit))...)
+	}
+	if len(gusts) < 2 {
+		return out, nil
+	}
+	for n, kt := range thresholds {
+		limit := kt * metresPerSecondPerKnot
+		sec4, err := probabilityProduct(gust, 22, n+1, len(thresholds), limit)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, gust.repack(gust.sec[3], sec4, exceedance(gusts, limit))...)
+	}
+	return out, nil
+}
+
+// Write the ensemble statistics for each step to fn. gribs are the member
+// forecast files, hours the forecast hour of each.
+func ensembleStatistics(fn string, gribs []string, hours []int) error {
+	thresholds, err := exceedanceThresholds()
+	if err != nil {
+		return err
+	}
+	var order []int
+	byHour := map[int][]string{}
+	for i, g := range gribs {
+		if _, ok := byHour[hours[i]]; !ok {
+			order = append(order, hours[i])
+		}
+		byHour[hours[i]] = append(byHour[hours[i]], g)
+	}
+
+	out, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	for _, h := range order {
+		data, err := stepStatistics(byHour[h], thresholds)
+		if err != nil {
+			log.Printf("No ensemble statistics for hour %d: %v\n", h, err)
+			continue
+		}
+		if _, err := out.Write(data); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	st, _ := os.Stat(fn)
+	log.Printf("GRIB %s %s (%d bytes)\n", fn, prettyInt(st.Size()), st.Size())
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import "encoding/binary"
+import "fmt"
+import "math"
+import "os"
+import "path/filepath"
+import "reflect"
+import "testing"
+
+func TestMeanStdDev(t *testing.T) {
+	nan := math.NaN()
+	fields := [][]float64{{2, 1, nan}, {4, 1, nan}, {6, nan, nan}, {8, 1, nan}}
+	mean, sd := meanStdDev(fields)
+	checkValues(t, mean, []float64{5, 1, nan}, 1e-12)
+	checkValues(t, sd, []float64{math.Sqrt(5), 0, nan}, 1e-12)
+	checkValues(t, exceedance(fields, 3), []float64{75, 0, nan}, 1e-12)
+}
+
+func TestParseThresholds(t *testing.T) {
+	if got, err := parseThresholds("15, 20,25.5"); err != nil || !reflect.DeepEqual(got, []float64{15, 20, 25.5}) {
+		t.Errorf("got %v %v", got, err)
+	}
+	for _, bad := range []string{"", "15,,20", "20kt", "-5"} {
+		if _, err := parseThresholds(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+// Three members with 10 m winds of 5, 10 and 15 m/s at every point
+func TestStepStatistics(t *testing.T) {
+	saveZ := Z
+	defer func() { Z = saveZ }()
+	Z = Zone{}
+	g := testLatLonGrid(2, 2, 38, 237, 0.5)
+	dir := t.TempDir()
+	var files []string
+	for n, speed := range []float64{5, 10, 15} {
+		u := []float64{0.6 * speed, 0.6 * speed, 0.6 * speed, 0.6 * speed}
+		v := []float64{0.8 * speed, 0.8 * speed, 0.8 * speed, 0.8 * speed}
+		fn := filepath.Join(dir, fmt.Sprintf("gep%02d.grib2", n+1))
+		data := append(testMessage(g, 2, 2, 6, 2, u), testMessage(g, 2, 3, 6, 2, v)...)
+		if err := os.WriteFile(fn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fn)
+	}
+
+	// 15 and 25 knots are 7.7 and 12.9 m/s
+	data, err := stepStatistics(files, []float64{15, 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := parseGrib2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		template int
+		want     float64
+	}{
+		{2, 10},                    // Mean
+		{2, math.Sqrt(50.0 / 3.0)}, // Standard deviation
+		{5, 200.0 / 3.0},           // Above 15 knots
+		{5, 100.0 / 3.0},           // Above 25 knots
+	}
+	fields := gribFields(msgs)
+	if len(fields) != len(tests) {
+		t.Fatalf("%d fields, want %d", len(fields), len(tests))
+	}
+	for i, tc := range tests {
+		f := fields[i]
+		if f.productTemplate != tc.template || f.name() != "WIND" {
+			t.Errorf("field %d: template 4.%d %s", i, f.productTemplate, f)
+		}
+		vals, err := f.values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkValues(t, vals, []float64{tc.want, tc.want, tc.want, tc.want}, 0.01)
+	}
+	// The derived forecast type and number of members, and the thresholds
+	if d := fields[1].sec[4][34:36]; d[0] != derivedStdDev || d[1] != 3 {
+		t.Errorf("standard deviation: derived %d of %d members", d[0], d[1])
+	}
+	if limit := binary.BigEndian.Uint32(fields[3].sec[4][43:]); fields[3].sec[4][34] != 2 || limit != 1286 {
+		t.Errorf("second probability: number %d limit %d", fields[3].sec[4][34], limit)
+	}
+
+	if _, err := stepStatistics(files[:1], []float64{15}); err == nil {
+		t.Error("one member: no error")
+	}
+}
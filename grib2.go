@@ -0,0 +1,333 @@
+package main
+
+import "os"
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "time"
+
+// A minimal GRIB2 reader. It walks the sections of each message, checks the
+// lengths and end markers, and decodes enough of the identification and
+// product definition to say what each field is and when it's valid.
+// References are to the WMO Manual on Codes, FM 92 GRIB Edition 2.
+
+var errNotGrib = errors.New("not a GRIB file")
+
+// One message. A message can hold several fields that share some sections.
+type grib2Message struct {
+	offset     int64 // Where the message starts in the file
+	discipline int   // Code table 0.0 (0 meteorological, 10 oceanographic)
+	raw        []byte
+	fields     []*grib2Field
+}
+
+// One field: a product on a grid. The sec slices point into the message's
+// raw bytes; sec[2] (local use) and sec[6] (bitmap) may be nil.
+type grib2Field struct {
+	msg *grib2Message
+	sec [8][]byte
+
+	center       int       // Originating centre (7 is NCEP)
+	refTime      time.Time // Reference time, usually the model cycle
+	gridTemplate int       // Template 3.N
+	gridPoints   int       // Number of points in the grid
+
+	productTemplate int // Template 4.N
+	category        int // Parameter category (code table 4.1)
+	parameter       int // Parameter number (code table 4.2)
+	forecast        time.Duration
+	endTime         time.Time // End of the statistical interval for accumulations, averages, etc.
+	level1          gribLevel
+	level2          gribLevel
+
+	dataTemplate int // Template 5.N
+	dataPoints   int // Number of packed values (excludes bitmapped-out points)
+}
+
+// A fixed surface from the product definition (code table 4.5)
+type gribLevel struct {
+	surface int // 255 is missing
+	scale   int
+	value   int
+}
+
+func (l gribLevel) float() float64 {
+	v := float64(l.value)
+	for s := l.scale; s > 0; s-- {
+		v /= 10
+	}
+	for s := l.scale; s < 0; s++ {
+		v *= 10
+	}
+	return v
+}
+
+// When the field is valid - the end of the interval for statistical products
+func (f *grib2Field) validTime() time.Time {
+	if !f.endTime.IsZero() {
+		return f.endTime
+	}
+	return f.refTime.Add(f.forecast)
+}
+
+func (f *grib2Field) String() string {
+	return fmt.Sprintf("%s:%s ref %s +%s", f.name(), levelName(f.level1, f.level2), f.refTime.Format("2006-01-02T15Z"), f.forecast)
+}
+
+// Read and validate every message in a file. Anything that isn't a complete
+// GRIB2 message - including a truncated download - is an error.
+func readGrib2File(fn string) ([]*grib2Message, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	return parseGrib2(data)
+}
+
+func parseGrib2(data []byte) ([]*grib2Message, error) {
+	if len(data) < 4 || string(data[:4]) != "GRIB" {
+		return nil, errNotGrib
+	}
+	var msgs []*grib2Message
+	offset := int64(0)
+	for offset < int64(len(data)) {
+		m, err := parseGrib2Message(data[offset:], offset)
+		if err != nil {
+			return msgs, fmt.Errorf("message %d at byte %d: %v", len(msgs)+1, offset, err)
+		}
+		msgs = append(msgs, m)
+		offset += int64(len(m.raw))
+	}
+	return msgs, nil
+}
+
+// Just the fields of all the messages
+func gribFields(msgs []*grib2Message) []*grib2Field {
+	var fields []*grib2Field
+	for _, m := range msgs {
+		fields = append(fields, m.fields...)
+	}
+	return fields
+}
+
+func parseGrib2Message(data []byte, offset int64) (*grib2Message, error) {
+	// Section 0 - Indicator
+	if len(data) < 16 {
+		return nil, fmt.Errorf("truncated indicator section (%d bytes)", len(data))
+	}
+	if string(data[:4]) != "GRIB" {
+		return nil, fmt.Errorf("no GRIB marker")
+	}
+	if data[7] != 2 {
+		return nil, fmt.Errorf("GRIB edition %d, only edition 2 is supported", data[7])
+	}
+	length := binary.BigEndian.Uint64(data[8:16])
+	if length < 16+4 {
+		return nil, fmt.Errorf("bad message length %d", length)
+	}
+	if length > uint64(len(data)) {
+		return nil, fmt.Errorf("truncated: message length %d, only %d bytes remain", length, len(data))
+	}
+	m := &grib2Message{offset: offset, discipline: int(data[6]), raw: data[:length]}
+	if string(m.raw[length-4:]) != "7777" {
+		return nil, fmt.Errorf("missing 7777 end marker")
+	}
+
+	// Sections 1-7. Section 1 comes once, then 2-7 repeat with 2 and 3 optional
+	// after the first field (a field reuses the previous sections).
+	var cur grib2Field
+	cur.msg = m
+	last := 0
+	pos := uint64(16)
+	for {
+		if pos+4 > length {
+			return nil, fmt.Errorf("truncated at byte %d", pos)
+		}
+		if string(m.raw[pos:pos+4]) == "7777" {
+			if pos+4 != length {
+				return nil, fmt.Errorf("end marker at byte %d of %d", pos, length)
+			}
+			break
+		}
+		if pos+5 > length {
+			return nil, fmt.Errorf("truncated section header at byte %d", pos)
+		}
+		slen := uint64(binary.BigEndian.Uint32(m.raw[pos:]))
+		num := int(m.raw[pos+4])
+		if slen < 5 || pos+slen > length-4 {
+			return nil, fmt.Errorf("section %d at byte %d has bad length %d", num, pos, slen)
+		}
+		if !nextSectionOK(last, num) {
+			return nil, fmt.Errorf("section %d follows section %d", num, last)
+		}
+		sec := m.raw[pos : pos+slen]
+		var err error
+		switch num {
+		case 1:
+			err = cur.parseIdentification(sec)
+		case 2:
+			cur.sec[2] = sec
+		case 3:
+			err = cur.parseGrid(sec)
+		case 4:
+			err = cur.parseProduct(sec)
+		case 5:
+			err = cur.parseDataRepresentation(sec)
+		case 6:
+			if len(sec) < 6 {
+				err = fmt.Errorf("short section 6")
+			} else if sec[5] == 254 {
+				if cur.sec[6] == nil {
+					err = fmt.Errorf("bitmap refers to a previous bitmap that doesn't exist")
+				}
+			} else {
+				cur.sec[6] = sec
+				if sec[5] == 0 && len(sec)-6 < (cur.gridPoints+7)/8 {
+					err = fmt.Errorf("bitmap has %d bytes for %d points", len(sec)-6, cur.gridPoints)
+				}
+			}
+		case 7:
+			cur.sec[7] = sec
+			f := cur
+			if f.sec[6] != nil && f.sec[6][5] == 255 {
+				f.sec[6] = nil
+			}
+			m.fields = append(m.fields, &f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %v", num, err)
+		}
+		last = num
+		pos += slen
+	}
+	if last != 7 {
+		return nil, fmt.Errorf("ends after section %d", last)
+	}
+	return m, nil
+}
+
+// Section order within a message
+func nextSectionOK(last, next int) bool {
+	switch last {
+	case 0:
+		return next == 1
+	case 1:
+		return next == 2 || next == 3
+	case 7:
+		return next == 2 || next == 3 || next == 4
+	}
+	return next == last+1 || (last == 2 && next == 3)
+}
+
+func (f *grib2Field) parseIdentification(sec []byte) error {
+	if len(sec) < 21 {
+		return fmt.Errorf("short identification section")
+	}
+	f.sec[1] = sec
+	f.center = int(binary.BigEndian.Uint16(sec[5:]))
+	f.refTime = time.Date(int(binary.BigEndian.Uint16(sec[12:])), time.Month(sec[14]), int(sec[15]), int(sec[16]), int(sec[17]), int(sec[18]), 0, time.UTC)
+	return nil
+}
+
+func (f *grib2Field) parseGrid(sec []byte) error {
+	if len(sec) < 14 {
+		return fmt.Errorf("short grid definition section")
+	}
+	f.sec[3] = sec
+	f.gridPoints = int(binary.BigEndian.Uint32(sec[6:]))
+	f.gridTemplate = int(binary.BigEndian.Uint16(sec[12:]))
+	return nil
+}
+
+func (f *grib2Field) parseProduct(sec []byte) error {
+	if len(sec) < 9 {
+		return fmt.Errorf("short product definition section")
+	}
+	if f.sec[3] == nil {
+		return fmt.Errorf("product definition without a grid")
+	}
+	f.sec[4] = sec
+	f.productTemplate = int(binary.BigEndian.Uint16(sec[7:]))
+	f.endTime = time.Time{}
+	if len(sec) < 11 {
+		return fmt.Errorf("template 4.%d too short", f.productTemplate)
+	}
+	f.category = int(sec[9])
+	f.parameter = int(sec[10])
+
+	// Templates 4.0-4.15 share the layout through the fixed surfaces
+	if f.productTemplate > 15 {
+		f.level1 = gribLevel{surface: 255}
+		f.level2 = gribLevel{surface: 255}
+		return nil
+	}
+	if len(sec) < 34 {
+		return fmt.Errorf("template 4.%d too short", f.productTemplate)
+	}
+	unit, ok := gribTimeUnits[int(sec[17])]
+	if !ok {
+		return fmt.Errorf("unknown time unit %d", sec[17])
+	}
+	f.forecast = time.Duration(gribInt32(sec[18:])) * unit
+	f.level1 = gribLevel{int(sec[22]), gribInt8(sec[23]), gribInt32(sec[24:])}
+	f.level2 = gribLevel{int(sec[28]), gribInt8(sec[29]), gribInt32(sec[30:])}
+
+	// Statistical products record the end of the interval
+	endAt := map[int]int{8: 34, 9: 47, 10: 35, 11: 37, 12: 36}[f.productTemplate]
+	if endAt > 0 && len(sec) >= endAt+7 {
+		e := sec[endAt:]
+		f.endTime = time.Date(int(binary.BigEndian.Uint16(e)), time.Month(e[2]), int(e[3]), int(e[4]), int(e[5]), int(e[6]), 0, time.UTC)
+	}
+	return nil
+}
+
+func (f *grib2Field) parseDataRepresentation(sec []byte) error {
+	if len(sec) < 11 {
+		return fmt.Errorf("short data representation section")
+	}
+	if f.sec[4] == nil {
+		return fmt.Errorf("data representation without a product")
+	}
+	f.sec[5] = sec
+	f.dataPoints = int(binary.BigEndian.Uint32(sec[5:]))
+	f.dataTemplate = int(binary.BigEndian.Uint16(sec[9:]))
+	if f.dataPoints > f.gridPoints {
+		return fmt.Errorf("%d values for a %d point grid", f.dataPoints, f.gridPoints)
+	}
+	return nil
+}
+
+// Code table 4.4
+var gribTimeUnits = map[int]time.Duration{
+	0:  time.Minute,
+	1:  time.Hour,
+	2:  24 * time.Hour,
+	10: 3 * time.Hour,
+	11: 6 * time.Hour,
+	12: 12 * time.Hour,
+	13: time.Second,
+}
+
+// GRIB2 stores negative numbers as sign and magnitude, not two's complement
+func gribInt32(b []byte) int {
+	v := binary.BigEndian.Uint32(b)
+	if v&0x80000000 != 0 {
+		return -int(v & 0x7fffffff)
+	}
+	return int(v)
+}
+
+func gribInt16(b []byte) int {
+	v := binary.BigEndian.Uint16(b)
+	if v&0x8000 != 0 {
+		return -int(v & 0x7fff)
+	}
+	return int(v)
+}
+
+func gribInt8(b byte) int {
+	if b&0x80 != 0 {
+		return -int(b & 0x7f)
+	}
+	return int(b)
+}
@@ -0,0 +1,134 @@
+package main
+
+import "encoding/binary"
+import "errors"
+import "testing"
+import "time"
+
+// Section 1: NCEP, reference time 2026-07-06 12z
+func testIdentification() []byte {
+	tmpl := make([]byte, 16)
+	binary.BigEndian.PutUint16(tmpl[0:], 7)
+	binary.BigEndian.PutUint16(tmpl[7:], 2026)
+	tmpl[9], tmpl[10], tmpl[11] = 7, 6, 12
+	return gribSection(1, tmpl)
+}
+
+// Section 3, template 3.0 with nx * ny points
+func testGrid(nx, ny int) []byte {
+	tmpl := make([]byte, 67)
+	binary.BigEndian.PutUint32(tmpl[1:], uint32(nx*ny))
+	binary.BigEndian.PutUint32(tmpl[25:], uint32(nx))
+	binary.BigEndian.PutUint32(tmpl[29:], uint32(ny))
+	return gribSection(3, tmpl)
+}
+
+// Section 4, template 4.0: a forecast hour at 10 m above ground
+func testProduct(category, parameter, hour int) []byte {
+	tmpl := make([]byte, 29)
+	tmpl[4], tmpl[5] = byte(category), byte(parameter)
+	tmpl[12] = 1 // Hours
+	binary.BigEndian.PutUint32(tmpl[13:], uint32(hour))
+	tmpl[17] = 103
+	binary.BigEndian.PutUint32(tmpl[19:], 10)
+	tmpl[23] = 255
+	return gribSection(4, tmpl)
+}
+
+// Section 4, template 4.8: an accumulation at the surface from hour from to
+// hour to
+func testAccumulation(category, parameter, from, to int) []byte {
+	tmpl := make([]byte, 53)
+	tmpl[3] = 8
+	tmpl[4], tmpl[5] = byte(category), byte(parameter)
+	tmpl[12] = 1
+	binary.BigEndian.PutUint32(tmpl[13:], uint32(from))
+	tmpl[17], tmpl[23] = 1, 255
+	end := time.Date(2026, 7, 6, 12+to, 0, 0, 0, time.UTC)
+	binary.BigEndian.PutUint16(tmpl[29:], uint16(end.Year()))
+	tmpl[31], tmpl[32], tmpl[33] = byte(end.Month()), byte(end.Day()), byte(end.Hour())
+	return gribSection(4, tmpl)
+}
+
+// Sections 5-7 for n values, template 5.0 with no bitmap. The values aren't
+// decoded so the data is just the right size.
+func testData(n int) [][]byte {
+	tmpl := make([]byte, 16)
+	binary.BigEndian.PutUint32(tmpl[0:], uint32(n))
+	tmpl[14] = 8 // Bits per value
+	return [][]byte{gribSection(5, tmpl), gribSection(6, []byte{255}), gribSection(7, make([]byte, n))}
+}
+
+func testSections(parts ...[][]byte) [][]byte {
+	var sections [][]byte
+	for _, p := range parts {
+		sections = append(sections, p...)
+	}
+	return sections
+}
+
+func TestParseGrib2(t *testing.T) {
+	// UGRD in one message, then VGRD and APCP sharing a grid in the next
+	data := gribMessage(0, testSections([][]byte{testIdentification(), testGrid(3, 2), testProduct(2, 2, 6)}, testData(6))...)
+	data = append(data, gribMessage(0, testSections([][]byte{testIdentification(), testGrid(3, 2), testProduct(2, 3, 6)}, testData(6),
+		[][]byte{testAccumulation(1, 8, 6, 9)}, testData(6))...)...)
+
+	msgs, err := parseGrib2(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[1].offset != int64(len(msgs[0].raw)) || len(msgs[1].fields) != 2 {
+		t.Fatalf("%d messages", len(msgs))
+	}
+	ref := time.Date(2026, 7, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		category, parameter int
+		level               gribLevel
+		valid               time.Time
+	}{
+		{2, 2, gribLevel{103, 0, 10}, ref.Add(6 * time.Hour)},
+		{2, 3, gribLevel{103, 0, 10}, ref.Add(6 * time.Hour)},
+		{1, 8, gribLevel{1, 0, 0}, ref.Add(9 * time.Hour)},
+	}
+	fields := gribFields(msgs)
+	if len(fields) != len(tests) {
+		t.Fatalf("%d fields", len(fields))
+	}
+	for i, tc := range tests {
+		f := fields[i]
+		if f.category != tc.category || f.parameter != tc.parameter || f.level1 != tc.level || !f.validTime().Equal(tc.valid) {
+			t.Errorf("field %d: %s valid %s", i, f, f.validTime())
+		}
+		if f.center != 7 || !f.refTime.Equal(ref) || f.gridPoints != 6 || f.dataPoints != 6 || f.sec[6] != nil {
+			t.Errorf("field %d: centre %d ref %s %d points %d values", i, f.center, f.refTime, f.gridPoints, f.dataPoints)
+		}
+	}
+}
+
+func TestParseGrib2Errors(t *testing.T) {
+	msg := gribMessage(0, testSections([][]byte{testIdentification(), testGrid(3, 2), testProduct(2, 2, 6)}, testData(6))...)
+	bad := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte{}, msg...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", msg[:len(msg)-1]},
+		{"no end marker", bad(func(b []byte) []byte { b[len(b)-1] = 'x'; return b })},
+		{"edition 1", bad(func(b []byte) []byte { b[7] = 1; return b })},
+		{"section length", bad(func(b []byte) []byte { b[16+3] = 200; return b })},
+		{"trailing junk", append(append([]byte{}, msg...), "GRIB"...)},
+		{"section order", gribMessage(0, testIdentification(), testProduct(2, 2, 6), testGrid(3, 2))},
+		{"too many values", gribMessage(0, testSections([][]byte{testIdentification(), testGrid(3, 2), testProduct(2, 2, 6)}, testData(7))...)},
+		{"no data", gribMessage(0, testIdentification(), testGrid(3, 2), testProduct(2, 2, 6))},
+	}
+	for _, tc := range tests {
+		if _, err := parseGrib2(tc.data); err == nil {
+			t.Errorf("%s: no error", tc.name)
+		}
+	}
+	if _, err := parseGrib2([]byte("<html>")); !errors.Is(err, errNotGrib) {
+		t.Errorf("HTML: %v", err)
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "image"
+import "image/png"
+import "math"
+
+// Unpacking and packing the data values of a GRIB2 field. Values come back
+// one per grid point in scan order with NaN for missing points (bitmap or
+// missing value management). Packing always writes simple packing (5.0),
+// or IEEE (5.4) if that's what the field came with.
+
+// Reads big-endian bit fields from a byte slice
+type bitReader struct {
+	data []byte
+	pos  uint64 // bit offset
+}
+
+func (b *bitReader) read(nbits int) (uint64, error) {
+	if nbits == 0 {
+		return 0, nil
+	}
+	if b.pos+uint64(nbits) > uint64(len(b.data))*8 {
+		return 0, fmt.Errorf("data section too short")
+	}
+	var v uint64
+	for n := 0; n < nbits; n++ {
+		byt := b.data[b.pos>>3]
+		bit := (byt >> (7 - b.pos&7)) & 1
+		v = v<<1 | uint64(bit)
+		b.pos++
+	}
+	return v, nil
+}
+
+// Sign and magnitude
+func (b *bitReader) readSigned(nbits int) (int64, error) {
+	sign, err := b.read(1)
+	if err != nil {
+		return 0, err
+	}
+	v, err := b.read(nbits - 1)
+	if sign == 1 {
+		return -int64(v), err
+	}
+	return int64(v), err
+}
+
+func (b *bitReader) align() {
+	b.pos = (b.pos + 7) &^ 7
+}
+
+// Writes big-endian bit fields
+type bitWriter struct {
+	data  []byte
+	nbits uint
+}
+
+func (b *bitWriter) write(v uint64, nbits int) {
+	for n := nbits - 1; n >= 0; n-- {
+		if b.nbits%8 == 0 {
+			b.data = append(b.data, 0)
+		}
+		if (v>>uint(n))&1 == 1 {
+			b.data[len(b.data)-1] |= 1 << (7 - b.nbits%8)
+		}
+		b.nbits++
+	}
+}
+
+// The scaling shared by templates 5.0, 5.2, 5.3 and 5.41
+type gribPacking struct {
+	ref      float64 // R
+	binary   int     // E
+	decimal  int     // D
+	nbits    int
+	origType byte // Code table 5.1 - 0 floating point, 1 integer
+}
+
+func parsePacking(sec5 []byte) (gribPacking, error) {
+	if len(sec5) < 21 {
+		return gribPacking{}, fmt.Errorf("short data representation section")
+	}
+	return gribPacking{
+		ref:      float64(math.Float32frombits(binary.BigEndian.Uint32(sec5[11:]))),
+		binary:   gribInt16(sec5[15:]),
+		decimal:  gribInt16(sec5[17:]),
+		nbits:    int(sec5[19]),
+		origType: sec5[20],
+	}, nil
+}
+
+func (p gribPacking) value(x float64) float64 {
+	return (p.ref + x*math.Pow(2, float64(p.binary))) / math.Pow(10, float64(p.decimal))
+}
+
+// Can we unpack this field?
+func (f *grib2Field) unpackable() bool {
+	switch f.dataTemplate {
+	case 0, 2, 3, 4, 41:
+		return true
+	}
+	return false
+}
+
+// The field's values, one per grid point
+func (f *grib2Field) values() ([]float64, error) {
+	packed, err := f.unpack()
+	if err != nil {
+		return nil, err
+	}
+	if len(packed) != f.dataPoints {
+		return nil, fmt.Errorf("unpacked %d values, expected %d", len(packed), f.dataPoints)
+	}
+	if f.sec[6] == nil {
+		if f.dataPoints != f.gridPoints {
+			return nil, fmt.Errorf("%d values for %d grid points and no bitmap", f.dataPoints, f.gridPoints)
+		}
+		return packed, nil
+	}
+	if f.sec[6][5] != 0 {
+		return nil, fmt.Errorf("predefined bitmap %d not supported", f.sec[6][5])
+	}
+	vals := make([]float64, f.gridPoints)
+	bitmap := f.sec[6][6:]
+	n := 0
+	for i := range vals {
+		if bitmap[i>>3]&(0x80>>(i&7)) != 0 {
+			if n >= len(packed) {
+				return nil, fmt.Errorf("bitmap has more points than values")
+			}
+			vals[i] = packed[n]
+			n++
+		} else {
+			vals[i] = math.NaN()
+		}
+	}
+	return vals, nil
+}
+
+// The packed values, before applying the bitmap
+func (f *grib2Field) unpack() ([]float64, error) {
+	sec5, data := f.sec[5], f.sec[7][5:]
+	switch f.dataTemplate {
+	case 0:
+		return unpackSimple(sec5, data, f.dataPoints)
+	case 2, 3:
+		return unpackComplex(sec5, data, f.dataPoints, f.dataTemplate == 3)
+	case 4:
+		return unpackIEEE(sec5, data, f.dataPoints)
+	case 41:
+		return unpackPNG(sec5, data, f.dataPoints)
+	}
+	return nil, fmt.Errorf("data template 5.%d not supported", f.dataTemplate)
+}
+
+func unpackSimple(sec5, data []byte, n int) ([]float64, error) {
+	p, err := parsePacking(sec5)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]float64, n)
+	if p.nbits == 0 {
+		for i := range vals {
+			vals[i] = p.value(0)
+		}
+		return vals, nil
+	}
+	b := bitReader{data: data}
+	for i := range vals {
+		x, err := b.read(p.nbits)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = p.value(float64(x))
+	}
+	return vals, nil
+}
+
+func unpackIEEE(sec5, data []byte, n int) ([]float64, error) {
+	if len(sec5) < 12 {
+		return nil, fmt.Errorf("short data representation section")
+	}
+	size := 4
+	if sec5[11] == 2 {
+		size = 8
+	}
+	if len(data) < n*size {
+		return nil, fmt.Errorf("data section too short")
+	}
+	vals := make([]float64, n)
+	for i := range vals {
+		if size == 4 {
+			vals[i] = float64(math.Float32frombits(binary.BigEndian.Uint32(data[i*4:])))
+		} else {
+			vals[i] = math.Float64frombits(binary.BigEndian.Uint64(data[i*8:]))
+		}
+	}
+	return vals, nil
+}
+
+func unpackPNG(sec5, data []byte, n int) ([]float64, error) {
+	p, err := parsePacking(sec5)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]float64, n)
+	if p.nbits == 0 || len(data) == 0 {
+		for i := range vals {
+			vals[i] = p.value(0)
+		}
+		return vals, nil
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	if b.Dx()*b.Dy() < n {
+		return nil, fmt.Errorf("PNG %dx%d for %d values", b.Dx(), b.Dy(), n)
+	}
+	for i := range vals {
+		x, y := b.Min.X+i%b.Dx(), b.Min.Y+i/b.Dx()
+		var v uint32
+		switch im := img.(type) {
+		case *image.Gray:
+			v = uint32(im.GrayAt(x, y).Y)
+		case *image.Gray16:
+			v = uint32(im.Gray16At(x, y).Y)
+		case *image.NRGBA:
+			c := im.NRGBAAt(x, y)
+			v = uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+		case *image.RGBA:
+			c := im.RGBAAt(x, y)
+			v = uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+		default:
+			return nil, fmt.Errorf("PNG color model %T not supported", img)
+		}
+		vals[i] = p.value(float64(v))
+	}
+	return vals, nil
+}
+
+// Complex packing (5.2) and complex packing with spatial differencing (5.3)
+func unpackComplex(sec5, data []byte, n int, spatial bool) ([]float64, error) {
+	p, err := parsePacking(sec5)
+	if err != nil {
+		return nil, err
+	}
+	if len(sec5) < 47 || (spatial && len(sec5) < 49) {
+		return nil, fmt.Errorf("short data representation section")
+	}
+	mvm := int(sec5[22])
+	ng := int(binary.BigEndian.Uint32(sec5[31:]))
+	widthRef := int(sec5[35])
+	widthBits := int(sec5[36])
+	lengthRef := int(binary.BigEndian.Uint32(sec5[37:]))
+	lengthIncr := int(sec5[41])
+	lastLength := int(binary.BigEndian.Uint32(sec5[42:]))
+	lengthBits := int(sec5[46])
+	order, ospd := 0, 0
+	if spatial {
+		order, ospd = int(sec5[47]), int(sec5[48])
+	}
+	if ng == 0 {
+		vals := make([]float64, n)
+		for i := range vals {
+			vals[i] = p.value(0)
+		}
+		return vals, nil
+	}
+
+	b := bitReader{data: data}
+	var first [2]int64
+	var minsd int64
+	if spatial && order > 0 {
+		for i := 0; i < order && i < 2; i++ {
+			v, err := b.read(ospd * 8)
+			if err != nil {
+				return nil, err
+			}
+			first[i] = int64(v)
+		}
+		if minsd, err = b.readSigned(ospd * 8); err != nil {
+			return nil, err
+		}
+	}
+
+	refs := make([]uint64, ng)
+	for g := range refs {
+		if refs[g], err = b.read(p.nbits); err != nil {
+			return nil, err
+		}
+	}
+	b.align()
+	widths := make([]int, ng)
+	for g := range widths {
+		w, err := b.read(widthBits)
+		if err != nil {
+			return nil, err
+		}
+		widths[g] = widthRef + int(w)
+	}
+	b.align()
+	lengths := make([]int, ng)
+	for g := range lengths {
+		l, err := b.read(lengthBits)
+		if err != nil {
+			return nil, err
+		}
+		lengths[g] = lengthRef + int(l)*lengthIncr
+	}
+	lengths[ng-1] = lastLength
+	b.align()
+
+	// Unpack the groups, noting missing values
+	ints := make([]int64, 0, n)
+	missing := make([]bool, 0, n)
+	for g := 0; g < ng; g++ {
+		w := widths[g]
+		for k := 0; k < lengths[g]; k++ {
+			x, err := b.read(w)
+			if err != nil {
+				return nil, err
+			}
+			miss := false
+			if mvm > 0 {
+				if w == 0 {
+					all := uint64(1)<<uint(p.nbits) - 1
+					miss = refs[g] == all || (mvm == 2 && refs[g] == all-1)
+				} else {
+					all := uint64(1)<<uint(w) - 1
+					miss = x == all || (mvm == 2 && x == all-1)
+				}
+			}
+			missing = append(missing, miss)
+			ints = append(ints, int64(refs[g]+x))
+		}
+	}
+	if len(ints) != n {
+		return nil, fmt.Errorf("groups hold %d values, expected %d", len(ints), n)
+	}
+
+	// Undo the spatial differencing over the non-missing values
+	if spatial && order > 0 {
+		var present []int
+		for i := range ints {
+			if !missing[i] {
+				present = append(present, i)
+			}
+		}
+		for k, i := range present {
+			switch {
+			case k < order:
+				ints[i] = first[k]
+			case order == 1:
+				ints[i] += minsd + ints[present[k-1]]
+			default:
+				ints[i] += minsd + 2*ints[present[k-1]] - ints[present[k-2]]
+			}
+		}
+	}
+
+	vals := make([]float64, n)
+	for i := range vals {
+		if missing[i] {
+			vals[i] = math.NaN()
+		} else {
+			vals[i] = p.value(float64(ints[i]))
+		}
+	}
+	return vals, nil
+}
+
+// Pack values (NaN for missing) as sections 5, 6 and 7. The binary and
+// decimal scale factors come from the original field so the precision is
+// the same; fields that arrived as IEEE floats stay that way.
+func packValues(orig []byte, vals []float64) (sec5, sec6, sec7 []byte) {
+	var present []float64
+	var bitmap []byte
+	for i, v := range vals {
+		if i%8 == 0 {
+			bitmap = append(bitmap, 0)
+		}
+		if !math.IsNaN(v) {
+			present = append(present, v)
+			bitmap[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	if len(present) == len(vals) {
+		sec6 = gribSection(6, []byte{255})
+	} else {
+		sec6 = gribSection(6, append([]byte{0}, bitmap...))
+	}
+
+	if binary.BigEndian.Uint16(orig[9:]) == 4 {
+		tmpl := make([]byte, 7)
+		binary.BigEndian.PutUint32(tmpl[0:], uint32(len(present)))
+		binary.BigEndian.PutUint16(tmpl[4:], 4)
+		tmpl[6] = 1 // 32 bit
+		data := make([]byte, 4*len(present))
+		for i, v := range present {
+			binary.BigEndian.PutUint32(data[i*4:], math.Float32bits(float32(v)))
+		}
+		return gribSection(5, tmpl), sec6, gribSection(7, data)
+	}
+
+	p, _ := parsePacking(orig)
+	scaleD := math.Pow(10, float64(p.decimal))
+	scaleE := math.Pow(2, float64(-p.binary))
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range present {
+		min = math.Min(min, v*scaleD)
+		max = math.Max(max, v*scaleD)
+	}
+	if len(present) == 0 {
+		min, max = 0, 0
+	}
+	// R is a float32 that must not be above the minimum
+	ref := float32(min)
+	if float64(ref) > min {
+		ref = math.Nextafter32(ref, float32(math.Inf(-1)))
+	}
+	nbits := 0
+	if span := math.Round((max - float64(ref)) * scaleE); span > 0 {
+		nbits = int(math.Ceil(math.Log2(span + 1)))
+	}
+	if nbits > 32 {
+		nbits = 32
+	}
+
+	var w bitWriter
+	if nbits > 0 {
+		for _, v := range present {
+			x := math.Round((v*scaleD - float64(ref)) * scaleE)
+			if x < 0 {
+				x = 0
+			}
+			w.write(uint64(x), nbits)
+		}
+	}
+
+	tmpl := make([]byte, 16)
+	binary.BigEndian.PutUint32(tmpl[0:], uint32(len(present)))
+	binary.BigEndian.PutUint16(tmpl[4:], 0)
+	binary.BigEndian.PutUint32(tmpl[6:], math.Float32bits(ref))
+	putGribInt16(tmpl[10:], p.binary)
+	putGribInt16(tmpl[12:], p.decimal)
+	tmpl[14] = byte(nbits)
+	tmpl[15] = p.origType
+	return gribSection(5, tmpl), sec6, gribSection(7, w.data)
+}
+
+// A section with its length and number in front of the contents
+func gribSection(num int, contents []byte) []byte {
+	sec := make([]byte, 5, 5+len(contents))
+	binary.BigEndian.PutUint32(sec, uint32(5+len(contents)))
+	sec[4] = byte(num)
+	return append(sec, contents...)
+}
+
+// A complete message from sections 1-7
+func gribMessage(discipline int, sections ...[]byte) []byte {
+	length := 16 + 4
+	for _, s := range sections {
+		length += len(s)
+	}
+	msg := make([]byte, 16, length)
+	copy(msg, "GRIB")
+	msg[6] = byte(discipline)
+	msg[7] = 2
+	binary.BigEndian.PutUint64(msg[8:], uint64(length))
+	for _, s := range sections {
+		msg = append(msg, s...)
+	}
+	return append(msg, "7777"...)
+}
+
+// The field as a message on its own, repacked with new grid and values
+func (f *grib2Field) repack(sec3, sec4 []byte, vals []float64) []byte {
+	sec5, sec6, sec7 := packValues(f.sec[5], vals)
+	if f.sec[2] != nil {
+		return gribMessage(f.msg.discipline, f.sec[1], f.sec[2], sec3, sec4, sec5, sec6, sec7)
+	}
+	return gribMessage(f.msg.discipline, f.sec[1], sec3, sec4, sec5, sec6, sec7)
+}
+
+// The field as a message on its own, unchanged
+func (f *grib2Field) message() []byte {
+	if len(f.msg.fields) == 1 {
+		return f.msg.raw
+	}
+	return f.withProduct(f.sec[4])
+}
+
+// The field as a message on its own with a different product definition
+func (f *grib2Field) withProduct(sec4 []byte) []byte {
+	sections := [][]byte{f.sec[1]}
+	if f.sec[2] != nil {
+		sections = append(sections, f.sec[2])
+	}
+	sections = append(sections, f.sec[3], sec4, f.sec[5])
+	if f.sec[6] != nil {
+		sections = append(sections, f.sec[6])
+	} else {
+		sections = append(sections, gribSection(6, []byte{255}))
+	}
+	sections = append(sections, f.sec[7])
+	return gribMessage(f.msg.discipline, sections...)
+}
+
+func putGribInt16(b []byte, v int) {
+	if v < 0 {
+		binary.BigEndian.PutUint16(b, uint16(-v)|0x8000)
+	} else {
+		binary.BigEndian.PutUint16(b, uint16(v))
+	}
+}
+
+func putGribInt32(b []byte, v int) {
+	if v < 0 {
+		binary.BigEndian.PutUint32(b, uint32(-v)|0x80000000)
+	} else {
+		binary.BigEndian.PutUint32(b, uint32(v))
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import "math"
+import "testing"
+
+func testLatLonGrid(nx, ny int, la1, lo1, d float64) *gribGrid {
+	g := &gribGrid{template: 0, nx: nx, ny: ny, resFlags: 0x30, earth: make([]byte, 16),
+		la1: la1, lo1: lo1, la2: la1 - float64(ny-1)*d, lo2: lo1 + float64(nx-1)*d, di: d, dj: d}
+	g.earth[0] = 6
+	g.radius = earthRadius(g.earth)
+	return g
+}
+
+// A message with one field of values on g, simply packed to 10^-decimal
+func testMessage(g *gribGrid, category, parameter, hour, decimal int, vals []float64) []byte {
+	sec5, sec6, sec7 := packValues(simplePacking(decimal), vals)
+	return gribMessage(0, testIdentification(), g.section(), testProduct(category, parameter, hour), sec5, sec6, sec7)
+}
+
+func parseTestField(t *testing.T, msg []byte) *grib2Field {
+	t.Helper()
+	msgs, err := parseGrib2(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gribFields(msgs)[0]
+}
+
+func checkValues(t *testing.T, got, want []float64, tolerance float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d values, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if math.IsNaN(want[i]) != math.IsNaN(got[i]) || math.Abs(got[i]-want[i]) > tolerance {
+			t.Errorf("value %d = %g, want %g", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPackValues(t *testing.T) {
+	g := testLatLonGrid(3, 2, 38, 237, 0.5)
+	tests := []struct {
+		decimal int
+		vals    []float64
+	}{
+		{2, []float64{1.25, -3.5, 0, 7.75, math.NaN(), 12}},
+		{1, []float64{285.1, 286.2, 287.3, 288.4, 289.5, 290.6}},
+		{0, []float64{4, 4, 4, 4, 4, 4}}, // No bits needed
+		{0, []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN()}},
+	}
+	for _, tc := range tests {
+		f := parseTestField(t, testMessage(g, 2, 2, 6, tc.decimal, tc.vals))
+		vals, err := f.values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkValues(t, vals, tc.vals, 0.5*math.Pow(10, -float64(tc.decimal)))
+
+		present := 0
+		for _, v := range tc.vals {
+			if !math.IsNaN(v) {
+				present++
+			}
+		}
+		if f.dataPoints != present || (f.sec[6] == nil) != (present == len(tc.vals)) {
+			t.Errorf("%v: %d data points, bitmap %v", tc.vals, f.dataPoints, f.sec[6] != nil)
+		}
+
+		// Repacked on the same grid it comes back the same
+		r := parseTestField(t, f.repack(f.sec[3], f.sec[4], vals))
+		rvals, err := r.values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkValues(t, rvals, vals, 1e-9)
+		if string(r.sec[3]) != string(f.sec[3]) || string(r.sec[5][11:]) != string(f.sec[5][11:]) {
+			t.Error("repack changed the grid or the precision")
+		}
+	}
+
+	// IEEE floats stay IEEE
+	ieee := gribSection(5, []byte{0, 0, 0, 6, 0, 4, 1})
+	sec5, sec6, sec7 := packValues(ieee, []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6})
+	f := parseTestField(t, gribMessage(0, testIdentification(), g.section(), testProduct(2, 2, 6), sec5, sec6, sec7))
+	vals, err := f.values()
+	if err != nil || f.dataTemplate != 4 {
+		t.Fatalf("template 5.%d: %v", f.dataTemplate, err)
+	}
+	checkValues(t, vals, []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6}, 1e-7)
+}
+
+// Complex packing with second-order spatial differencing (5.3) and a bitmap,
+// packed by hand: 1.0, missing, 1.2, 1.5, 1.3, 2.0 with D = 1
+func TestUnpackComplexBitmap(t *testing.T) {
+	g := testLatLonGrid(3, 2, 38, 237, 0.5)
+	sec5 := make([]byte, 49-5)
+	putGribInt32(sec5[0:], 5) // Values
+	putGribInt16(sec5[4:], 3) // Template 5.3
+	putGribInt16(sec5[12:], 1)
+	sec5[14] = 8               // Bits for group references
+	sec5[16] = 1               // Group splitting
+	putGribInt32(sec5[26:], 1) // One group
+	sec5[30] = 4               // Width 4 bits, no width bits
+	putGribInt32(sec5[32:], 5) // Length 5, no length bits
+	sec5[36] = 1
+	putGribInt32(sec5[37:], 5) // Last group length
+	sec5[42], sec5[43] = 2, 2  // Second order, two octets
+
+	// Present values 10 12 15 13 20: first two, minimum difference -5, one
+	// group reference, then differences less the minimum 0 0 6 0 14
+	sec7 := []byte{0x00, 0x0a, 0x00, 0x0c, 0x80, 0x05, 0x00, 0x00, 0x60, 0xe0}
+	msg := gribMessage(0, testIdentification(), g.section(), testProduct(2, 2, 6),
+		gribSection(5, sec5), gribSection(6, []byte{0, 0xbc}), gribSection(7, sec7))
+
+	f := parseTestField(t, msg)
+	if f.dataTemplate != 3 || !f.unpackable() {
+		t.Fatalf("template 5.%d", f.dataTemplate)
+	}
+	vals, err := f.values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{1.0, math.NaN(), 1.2, 1.5, 1.3, 2.0}
+	checkValues(t, vals, want, 1e-9)
+
+	// Repacking writes simple packing with the same precision and bitmap
+	f = parseTestField(t, f.repack(f.sec[3], f.sec[4], vals))
+	if f.dataTemplate != 0 || f.dataPoints != 5 {
+		t.Errorf("repacked as 5.%d with %d values", f.dataTemplate, f.dataPoints)
+	}
+	vals, err = f.values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, vals, want, 1e-6)
+}
@@ -0,0 +1,245 @@
+package main
+
+import "encoding/binary"
+import "fmt"
+import "math"
+
+// Grid definitions (section 3) for the two grid types NOMADS models use:
+// regular lat/lon (template 3.0 - GFS, GEFS, GFS-Wave) and Lambert conformal
+// (template 3.30 - HRRR, NAM nests). Grid indexes are in scan order: i
+// along a row, j from row to row, (0, 0) the first point in the file.
+
+type gribGrid struct {
+	template int
+	nx, ny   int
+	scan     byte // Scanning mode flags (table 3.4)
+	resFlags byte // Resolution and component flags (table 3.3)
+	earth    []byte
+	radius   float64 // Metres
+
+	// Template 3.0, degrees
+	la1, lo1, la2, lo2 float64
+	di, dj             float64
+
+	// Template 3.30, degrees and metres
+	lad, lov       float64
+	dx, dy         float64
+	latin1, latin2 float64
+	projFlag       byte
+	cone, f        float64 // Lambert constants
+	x1, y1         float64 // Projected first grid point
+	pole           []byte  // Southern pole of the projection, as is
+}
+
+// Table 3.3 bit 5 - u and v are relative to the grid rather than east/north
+const gridRelativeWinds = 0x08
+
+func (f *grib2Field) grid() (*gribGrid, error) {
+	sec := f.sec[3]
+	g := &gribGrid{template: f.gridTemplate}
+	if sec[5] != 0 || sec[10] != 0 {
+		return nil, fmt.Errorf("grid definition source %d with optional point list not supported", sec[5])
+	}
+	switch f.gridTemplate {
+	case 0:
+		if len(sec) < 72 {
+			return nil, fmt.Errorf("short grid template 3.0")
+		}
+		g.earth = sec[14:30]
+		g.nx = int(binary.BigEndian.Uint32(sec[30:]))
+		g.ny = int(binary.BigEndian.Uint32(sec[34:]))
+		unit := 1e-6
+		basic, subdiv := binary.BigEndian.Uint32(sec[38:]), binary.BigEndian.Uint32(sec[42:])
+		if basic != 0 && basic != 0xffffffff && subdiv != 0 && subdiv != 0xffffffff {
+			unit = float64(basic) / float64(subdiv)
+		}
+		g.la1 = float64(gribInt32(sec[46:])) * unit
+		g.lo1 = float64(gribInt32(sec[50:])) * unit
+		g.resFlags = sec[54]
+		g.la2 = float64(gribInt32(sec[55:])) * unit
+		g.lo2 = float64(gribInt32(sec[59:])) * unit
+		g.di = float64(binary.BigEndian.Uint32(sec[63:])) * unit
+		g.dj = float64(binary.BigEndian.Uint32(sec[67:])) * unit
+		g.scan = sec[71]
+	case 30:
+		if len(sec) < 81 {
+			return nil, fmt.Errorf("short grid template 3.30")
+		}
+		g.earth = sec[14:30]
+		g.nx = int(binary.BigEndian.Uint32(sec[30:]))
+		g.ny = int(binary.BigEndian.Uint32(sec[34:]))
+		la1 := float64(gribInt32(sec[38:])) * 1e-6
+		lo1 := float64(gribInt32(sec[42:])) * 1e-6
+		g.resFlags = sec[46]
+		g.lad = float64(gribInt32(sec[47:])) * 1e-6
+		g.lov = float64(gribInt32(sec[51:])) * 1e-6
+		g.dx = float64(binary.BigEndian.Uint32(sec[55:])) * 1e-3
+		g.dy = float64(binary.BigEndian.Uint32(sec[59:])) * 1e-3
+		g.projFlag = sec[63]
+		g.scan = sec[64]
+		g.latin1 = float64(gribInt32(sec[65:])) * 1e-6
+		g.latin2 = float64(gribInt32(sec[69:])) * 1e-6
+		g.pole = sec[73:81]
+		g.la1, g.lo1 = la1, lo1
+	default:
+		return nil, fmt.Errorf("grid template 3.%d not supported", f.gridTemplate)
+	}
+	if g.scan&0xb0 != 0 {
+		return nil, fmt.Errorf("scanning mode 0x%02x not supported", g.scan)
+	}
+	if g.nx*g.ny != f.gridPoints {
+		return nil, fmt.Errorf("%dx%d grid with %d points", g.nx, g.ny, f.gridPoints)
+	}
+	g.radius = earthRadius(g.earth)
+	if g.template == 30 {
+		g.lambertSetup()
+	}
+	return g, nil
+}
+
+// Code table 3.2. The ellipsoids are treated as spheres, which is what
+// the models themselves do for these grids.
+func earthRadius(earth []byte) float64 {
+	switch earth[0] {
+	case 0:
+		return 6367470
+	case 1:
+		r := float64(binary.BigEndian.Uint32(earth[2:]))
+		for s := int(earth[1]); s > 0; s-- {
+			r /= 10
+		}
+		return r
+	case 6, 8:
+		return 6371229
+	}
+	return 6371229
+}
+
+func radians(d float64) float64 { return d * math.Pi / 180 }
+func degrees(r float64) float64 { return r * 180 / math.Pi }
+
+// Longitude in [0, 360)
+func lon360(lon float64) float64 {
+	lon = math.Mod(lon, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return lon
+}
+
+func (g *gribGrid) lambertSetup() {
+	phi1, phi2 := radians(g.latin1), radians(g.latin2)
+	if math.Abs(phi1-phi2) < 1e-9 {
+		g.cone = math.Sin(phi1)
+	} else {
+		g.cone = math.Log(math.Cos(phi1)/math.Cos(phi2)) /
+			math.Log(math.Tan(math.Pi/4+phi2/2)/math.Tan(math.Pi/4+phi1/2))
+	}
+	g.f = math.Cos(phi1) * math.Pow(math.Tan(math.Pi/4+phi1/2), g.cone) / g.cone
+	g.x1, g.y1 = g.project(g.la1, g.lo1)
+}
+
+// Lambert conformal projection with the pole at the origin
+func (g *gribGrid) project(lat, lon float64) (x, y float64) {
+	rho := g.radius * g.f / math.Pow(math.Tan(math.Pi/4+radians(lat)/2), g.cone)
+	dlon := lon360(lon-g.lov+180) - 180
+	theta := g.cone * radians(dlon)
+	return rho * math.Sin(theta), -rho * math.Cos(theta)
+}
+
+func (g *gribGrid) unproject(x, y float64) (lat, lon float64) {
+	sign := 1.0
+	if g.cone < 0 {
+		sign = -1
+	}
+	rho := sign * math.Hypot(x, y)
+	theta := math.Atan2(sign*x, -sign*y)
+	lat = degrees(2*math.Atan(math.Pow(g.radius*g.f/rho, 1/g.cone)) - math.Pi/2)
+	lon = lon360(g.lov + degrees(theta/g.cone))
+	return lat, lon
+}
+
+func (g *gribGrid) iDir() float64 {
+	if g.scan&0x80 != 0 {
+		return -1
+	}
+	return 1
+}
+
+func (g *gribGrid) jDir() float64 {
+	if g.scan&0x40 != 0 {
+		return 1
+	}
+	return -1
+}
+
+// Latitude and longitude of a (possibly fractional) grid index
+func (g *gribGrid) latLon(i, j float64) (lat, lon float64) {
+	if g.template == 30 {
+		return g.unproject(g.x1+i*g.dx*g.iDir(), g.y1+j*g.dy*g.jDir())
+	}
+	return g.la1 + j*g.dj*g.jDir(), lon360(g.lo1 + i*g.di*g.iDir())
+}
+
+// Fractional grid index of a latitude and longitude. Points off the grid
+// give indexes outside [0, nx-1] x [0, ny-1].
+func (g *gribGrid) index(lat, lon float64) (i, j float64) {
+	if g.template == 30 {
+		x, y := g.project(lat, lon)
+		return (x - g.x1) / g.dx * g.iDir(), (y - g.y1) / g.dy * g.jDir()
+	}
+	j = (lat - g.la1) / g.dj * g.jDir()
+	i = lon360(lon-g.lo1) / g.di
+	// Just west of the first column is -1, not most of the way around
+	if !g.global() && i > float64(g.nx-1) && 360/g.di-i < i-float64(g.nx-1) {
+		i -= 360 / g.di
+	}
+	return i, j
+}
+
+// Does a lat/lon grid go all the way around?
+func (g *gribGrid) global() bool {
+	return g.template == 0 && math.Abs(float64(g.nx)*g.di-360) < g.di/2
+}
+
+// Section 3 for the grid
+func (g *gribGrid) section() []byte {
+	var tmpl []byte
+	switch g.template {
+	case 0:
+		tmpl = make([]byte, 72-5)
+		copy(tmpl[9:], g.earth)
+		binary.BigEndian.PutUint32(tmpl[25:], uint32(g.nx))
+		binary.BigEndian.PutUint32(tmpl[29:], uint32(g.ny))
+		binary.BigEndian.PutUint32(tmpl[37:], 0xffffffff) // Units of 10^-6 degree
+		putGribInt32(tmpl[41:], int(math.Round(g.la1*1e6)))
+		putGribInt32(tmpl[45:], int(math.Round(lon360(g.lo1)*1e6)))
+		tmpl[49] = g.resFlags
+		putGribInt32(tmpl[50:], int(math.Round(g.la2*1e6)))
+		putGribInt32(tmpl[54:], int(math.Round(lon360(g.lo2)*1e6)))
+		binary.BigEndian.PutUint32(tmpl[58:], uint32(math.Round(g.di*1e6)))
+		binary.BigEndian.PutUint32(tmpl[62:], uint32(math.Round(g.dj*1e6)))
+		tmpl[66] = g.scan
+	case 30:
+		tmpl = make([]byte, 81-5)
+		copy(tmpl[9:], g.earth)
+		binary.BigEndian.PutUint32(tmpl[25:], uint32(g.nx))
+		binary.BigEndian.PutUint32(tmpl[29:], uint32(g.ny))
+		putGribInt32(tmpl[33:], int(math.Round(g.la1*1e6)))
+		putGribInt32(tmpl[37:], int(math.Round(lon360(g.lo1)*1e6)))
+		tmpl[41] = g.resFlags
+		putGribInt32(tmpl[42:], int(math.Round(g.lad*1e6)))
+		putGribInt32(tmpl[46:], int(math.Round(lon360(g.lov)*1e6)))
+		binary.BigEndian.PutUint32(tmpl[50:], uint32(math.Round(g.dx*1e3)))
+		binary.BigEndian.PutUint32(tmpl[54:], uint32(math.Round(g.dy*1e3)))
+		tmpl[58] = g.projFlag
+		tmpl[59] = g.scan
+		putGribInt32(tmpl[60:], int(math.Round(g.latin1*1e6)))
+		putGribInt32(tmpl[64:], int(math.Round(g.latin2*1e6)))
+		copy(tmpl[68:], g.pole)
+	}
+	// Source 0, number of points, no optional list, template number
+	binary.BigEndian.PutUint32(tmpl[1:], uint32(g.nx*g.ny))
+	binary.BigEndian.PutUint16(tmpl[7:], uint16(g.template))
+	return gribSection(3, tmpl)
+}
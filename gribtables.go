@@ -0,0 +1,166 @@
+package main
+
+import "fmt"
+import "net/url"
+import "strings"
+
+// NCEP abbreviations for the parameters the zones ask for, keyed by
+// discipline, category and number (code tables 0.0, 4.1 and 4.2 plus the
+// NCEP local entries 192-254). These are the names the NOMADS filters use.
+var gribParams = map[[3]int]string{
+	{0, 0, 0}:    "TMP",
+	{0, 0, 4}:    "TMAX",
+	{0, 0, 5}:    "TMIN",
+	{0, 0, 6}:    "DPT",
+	{0, 1, 0}:    "SPFH",
+	{0, 1, 1}:    "RH",
+	{0, 1, 3}:    "PWAT",
+	{0, 1, 7}:    "PRATE",
+	{0, 1, 8}:    "APCP",
+	{0, 1, 9}:    "NCPCP",
+	{0, 1, 10}:   "ACPCP",
+	{0, 1, 11}:   "SNOD",
+	{0, 1, 12}:   "SRWEQ",
+	{0, 1, 13}:   "WEASD",
+	{0, 1, 22}:   "CLMR",
+	{0, 1, 23}:   "ICMR",
+	{0, 1, 29}:   "ASNOW",
+	{0, 1, 32}:   "GRLE",
+	{0, 1, 39}:   "CPOFP",
+	{0, 1, 192}:  "CRAIN",
+	{0, 1, 193}:  "CFRZR",
+	{0, 1, 194}:  "CICEP",
+	{0, 1, 195}:  "CSNOW",
+	{0, 1, 196}:  "CPRAT",
+	{0, 1, 198}:  "MINRH",
+	{0, 1, 199}:  "MAXRH",
+	{0, 2, 0}:    "WDIR",
+	{0, 2, 1}:    "WIND",
+	{0, 2, 2}:    "UGRD",
+	{0, 2, 3}:    "VGRD",
+	{0, 2, 8}:    "VVEL",
+	{0, 2, 22}:   "GUST",
+	{0, 2, 192}:  "VWSH",
+	{0, 2, 194}:  "USTM",
+	{0, 2, 195}:  "VSTM",
+	{0, 2, 250}:  "GUSTF", // Ours - see derive.go
+	{0, 3, 0}:    "PRES",
+	{0, 3, 1}:    "PRMSL",
+	{0, 3, 5}:    "HGT",
+	{0, 3, 192}:  "MSLET",
+	{0, 3, 198}:  "MSLMA",
+	{0, 6, 1}:    "TCDC",
+	{0, 6, 3}:    "LCDC",
+	{0, 6, 4}:    "MCDC",
+	{0, 6, 5}:    "HCDC",
+	{0, 7, 6}:    "CAPE",
+	{0, 7, 7}:    "CIN",
+	{0, 7, 192}:  "LFTX",
+	{0, 15, 3}:   "VIL",
+	{0, 16, 195}: "REFD",
+	{0, 16, 196}: "REFC",
+	{0, 16, 198}: "MAXREF",
+	{0, 17, 192}: "LTNG",
+	{0, 19, 0}:   "VIS",
+	{10, 0, 3}:   "HTSGW",
+	{10, 0, 4}:   "WVDIR",
+	{10, 0, 5}:   "WVHGT",
+	{10, 0, 6}:   "WVPER",
+	{10, 0, 7}:   "SWDIR",
+	{10, 0, 8}:   "SWELL",
+	{10, 0, 9}:   "SWPER",
+	{10, 0, 10}:  "DIRPW",
+	{10, 0, 11}:  "PERPW",
+	{10, 0, 12}:  "DIRSW",
+	{10, 0, 13}:  "PERSW",
+	{10, 1, 0}:   "DIRC",
+	{10, 1, 1}:   "SPC",
+	{10, 1, 2}:   "UOGRD",
+	{10, 1, 3}:   "VOGRD",
+	{10, 2, 0}:   "ICEC",
+	{10, 3, 0}:   "WTMP",
+	{10, 4, 3}:   "SALTY",
+}
+
+// Parameters in degrees, which interpolate the short way round
+var directionParams = map[string]bool{"WDIR": true, "WVDIR": true, "SWDIR": true, "DIRPW": true, "DIRSW": true, "DIRC": true}
+
+// Reverse lookup of gribParams
+var gribParamIds = func() map[string][3]int {
+	ids := map[string][3]int{}
+	for id, name := range gribParams {
+		ids[name] = id
+	}
+	return ids
+}()
+
+func (f *grib2Field) name() string {
+	if name, ok := gribParams[[3]int{f.msg.discipline, f.category, f.parameter}]; ok {
+		return name
+	}
+	return fmt.Sprintf("var%d_%d_%d", f.msg.discipline, f.category, f.parameter)
+}
+
+// The NOMADS filter name for a level (code table 4.5), e.g. 10_m_above_ground
+func levelName(l1, l2 gribLevel) string {
+	layer := l2.surface != 255 && l2.surface == l1.surface
+	switch l1.surface {
+	case 1:
+		return "surface"
+	case 2:
+		return "cloud_base"
+	case 3:
+		return "cloud_top"
+	case 4:
+		return "0C_isotherm"
+	case 8:
+		return "top_of_atmosphere"
+	case 10:
+		return "entire_atmosphere"
+	case 100:
+		if layer {
+			return fmt.Sprintf("%g-%g_mb", l1.float()/100, l2.float()/100)
+		}
+		return fmt.Sprintf("%g_mb", l1.float()/100)
+	case 101:
+		return "mean_sea_level"
+	case 102:
+		return fmt.Sprintf("%g_m_above_mean_sea_level", l1.float())
+	case 103:
+		if layer {
+			return fmt.Sprintf("%g-%g_m_above_ground", l1.float(), l2.float())
+		}
+		return fmt.Sprintf("%g_m_above_ground", l1.float())
+	case 106:
+		if layer {
+			return fmt.Sprintf("%g-%g_m_below_ground", l1.float(), l2.float())
+		}
+		return fmt.Sprintf("%g_m_below_ground", l1.float())
+	case 108:
+		return fmt.Sprintf("%g-%g_mb_above_ground", l1.float()/100, l2.float()/100)
+	case 160:
+		return fmt.Sprintf("%g_m_below_sea_level", l1.float())
+	case 200:
+		return "entire_atmosphere_(considered_as_a_single_layer)"
+	case 214:
+		return "low_cloud_layer"
+	case 220:
+		return "planetary_boundary_layer"
+	case 224:
+		return "middle_cloud_layer"
+	case 234:
+		return "high_cloud_layer"
+	case 241:
+		return fmt.Sprintf("%g_in_sequence", l1.float())
+	}
+	return fmt.Sprintf("level_%d", l1.surface)
+}
+
+// Zone levels are URL-escaped for the filter scripts -
+// entire_atmosphere_%5C%28considered_as_a_single_layer%5C%29
+func plainLevel(level string) string {
+	if s, err := url.QueryUnescape(level); err == nil {
+		level = s
+	}
+	return strings.ReplaceAll(level, "\\", "")
+}
@@ -0,0 +1,198 @@
+package main
+
+import "context"
+import "fmt"
+import "log"
+import "math"
+import "os"
+import "sort"
+import "strconv"
+import "strings"
+import "time"
+
+// HAFS, the hurricane model, runs once per active storm and NOMADS keeps
+// its output in a directory per storm ID (05l). Which storms are active in
+// a cycle comes from the tcvitals the GFS assimilates:
+//
+//   NHC  05L BERYL     20240705 0000 190N 0838W 290 082 0989 1008 ...
+//
+// A zone picks a storm by ID or name (or -storm), and either uses its own
+// bbox or one centred on the storm.
+
+var stormFlag string
+var listStorms bool
+
+// The storm being fetched, used by the URL templates
+var storm tcStorm
+
+type tcStorm struct {
+	center string // NHC, JTWC...
+	id     string // 05L
+	name   string
+	lat    float64
+	lon    float64
+}
+
+// Parse a tcvitals file. Storms can be listed more than once; the last wins.
+func parseTcvitals(data []byte) []tcStorm {
+	byId := map[string]tcStorm{}
+	var order []string
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 7 {
+			continue
+		}
+		lat, ok1 := tcvitalsDegrees(f[5], 'N', 'S')
+		lon, ok2 := tcvitalsDegrees(f[6], 'E', 'W')
+		if !ok1 || !ok2 {
+			continue
+		}
+		s := tcStorm{center: f[0], id: strings.ToUpper(f[1]), name: strings.ToUpper(f[2]), lat: lat, lon: lon}
+		if _, seen := byId[s.id]; !seen {
+			order = append(order, s.id)
+		}
+		byId[s.id] = s
+	}
+	var storms []tcStorm
+	for _, id := range order {
+		storms = append(storms, byId[id])
+	}
+	return storms
+}
+
+// 190N is 19.0, 0838W is -83.8
+func tcvitalsDegrees(s string, pos, neg byte) (float64, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	tenths, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, false
+	}
+	d := float64(tenths) / 10
+	switch s[len(s)-1] {
+	case pos:
+		return d, true
+	case neg:
+		return -d, true
+	}
+	return 0, false
+}
+
+// The active storms for the run at zulu
+func activeStorms(ctx context.Context) ([]tcStorm, error) {
+	data, err := newUrlData(zulu, 0, "", "", "")
+	url := ""
+	if err == nil {
+		url, err = expandUrl(M.stormurl, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, body, err := fetchBytes(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("storm list: %v", err)
+	}
+	return parseTcvitals(body), nil
+}
+
+// Pick the zone's storm for the run at zulu and centre the zone on it if
+// it asks. A no-op for models that aren't per storm.
+func selectStorm(ctx context.Context) error {
+	storm = tcStorm{}
+	if M.stormurl == "" {
+		return nil
+	}
+	storms, err := activeStorms(ctx)
+	if err != nil {
+		return err
+	}
+	if storm, err = matchStorm(storms, wantedStorm(Z)); err != nil {
+		return err
+	}
+	log.Printf("Storm %s %s at %.1f %.1f\n", storm.id, storm.name, storm.lat, storm.lon)
+
+	if Z.stormBox > 0 {
+		Z.longitude = Longitude{storm.lon - Z.stormBox, storm.lon + Z.stormBox}
+		Z.latitude = Latitude{math.Min(storm.lat+Z.stormBox, 90), math.Max(storm.lat-Z.stormBox, -90)}
+	}
+	// One composite per storm
+	Z.geo = Z.geo + "-" + strings.ToLower(storm.id)
+	return nil
+}
+
+// The storm asked for - -storm, else the zone's - by ID or name
+func wantedStorm(z Zone) string {
+	if stormFlag != "" {
+		return strings.ToUpper(stormFlag)
+	}
+	return strings.ToUpper(z.storm)
+}
+
+// The storm in the run at zulu with the ID or name want, or the only one if
+// want is empty. Two storms with the name are an error.
+func matchStorm(storms []tcStorm, want string) (tcStorm, error) {
+	var match []tcStorm
+	for _, s := range storms {
+		if want == "" || s.id == want || s.name == want {
+			match = append(match, s)
+		}
+	}
+	switch {
+	case len(storms) == 0:
+		return tcStorm{}, fmt.Errorf("no active storms in the %02dz cycle", zulu.Hour())
+	case len(match) == 0:
+		return tcStorm{}, fmt.Errorf("storm %s isn't active in the %02dz cycle (%s)", want, zulu.Hour(), stormNames(storms))
+	case len(match) > 1:
+		return tcStorm{}, fmt.Errorf("choose a storm with -storm: %s", stormNames(match))
+	}
+	return match[0], nil
+}
+
+func stormNames(storms []tcStorm) string {
+	var names []string
+	for _, s := range storms {
+		names = append(names, s.id+" "+s.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// -storms: list the active storms for the zone's model and whether HAFS has
+// posted each of them yet
+func printStorms(ctx context.Context) {
+	if M.stormurl == "" {
+		log.Printf("Model %s isn't run per storm\n", Z.model)
+		os.Exit(-1)
+	}
+	modelFrequency, _ := time.ParseDuration(M.modelFrequency)
+	zulu = time.Now().UTC().Truncate(modelFrequency)
+	if runFlag != "" {
+		var err error
+		if zulu, _, _, err = namedRun(ctx, time.Now().UTC(), runFlag); err != nil {
+			log.Printf("%v\n", err)
+			os.Exit(-1)
+		}
+	}
+	storms, err := activeStorms(ctx)
+	if err != nil {
+		// The newest cycle's list may not be out yet
+		zulu = zulu.Add(-modelFrequency)
+		storms, err = activeStorms(ctx)
+	}
+	if err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+	sort.Slice(storms, func(i, j int) bool { return storms[i].id < storms[j].id })
+	fmt.Printf("Active storms %s\n", zulu.Format("2006-01-02 15z"))
+	for _, s := range storms {
+		posted := "-"
+		if M.probeurl != "" {
+			storm = s
+			if ok, err := probeExists(ctx, zulu, 0); err == nil {
+				posted = map[bool]string{true: "posted", false: "not posted"}[ok]
+			}
+		}
+		fmt.Printf("%-4s %-5s %-12s %6.1f %7.1f  %s\n", s.center, s.id, s.name, s.lat, s.lon, posted)
+	}
+}
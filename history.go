@@ -0,0 +1,239 @@
+package main
+
+import "os"
+import "bufio"
+import "encoding/json"
+import "flag"
+import "fmt"
+import "log"
+import "math"
+import "path/filepath"
+import "sort"
+import "sync"
+import "time"
+
+// The start and end lags in models were measured by hand. Every time a
+// forecast of a run that's still posting comes down good, how long after the
+// cycle time that was is appended to a history file. `nomads schedule`
+// reports what's been seen and -learned-lags uses it to time fetches.
+// Forecasts of runs that finished long ago aren't recorded - they'd only
+// say when we got around to fetching them.
+
+var historyFile string
+var learnedLags bool
+
+// Forecast hours need this many observations before their lag is trusted
+const minHistory = 5
+
+// The percentile of observed lags used as the learned lag
+const learnedPercentile = 90
+
+type historyRecord struct {
+	Model    string    `json:"model"`
+	Cycle    time.Time `json:"cycle"`
+	Forecast int       `json:"forecast"`
+	Latency  float64   `json:"latency"` // Seconds after the cycle
+}
+
+type historyKey struct {
+	model    string
+	cycle    int // Hour
+	forecast int
+}
+
+var historyMu sync.Mutex
+var historySeen map[string]bool          // model/cycle/hour already recorded
+var historyLags map[historyKey][]float64 // Seconds, loaded on demand
+
+func defaultHistoryFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "nomads", "history.jsonl")
+}
+
+func historyPath() string {
+	if historyFile != "" {
+		return historyFile
+	}
+	return defaultHistoryFile()
+}
+
+func readHistory(fn string) ([]historyRecord, error) {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []historyRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r historyRecord
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			continue // A line cut short by a crash
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+func (r historyRecord) id() string {
+	return fmt.Sprintf("%s/%s/%d", r.Model, r.Cycle.Format("2006010215"), r.Forecast)
+}
+
+// Record that a forecast of the current run just came down good. Called
+// from the fetch threads.
+func recordAvailable(forecast int) {
+	if !inProgress {
+		return
+	}
+	r := historyRecord{Model: Z.model, Cycle: zulu, Forecast: forecast, Latency: math.Round(time.Since(zulu).Seconds())}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	fn := historyPath()
+	if historySeen == nil {
+		historySeen = map[string]bool{}
+		records, err := readHistory(fn)
+		if err != nil {
+			log.Printf("History: %v\n", err)
+		}
+		for _, old := range records {
+			historySeen[old.id()] = true
+		}
+	}
+	if historySeen[r.id()] {
+		return
+	}
+	historySeen[r.id()] = true
+
+	_ = os.MkdirAll(filepath.Dir(fn), 0755)
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("History: %v\n", err)
+		return
+	}
+	defer f.Close()
+	line, _ := json.Marshal(r)
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		log.Printf("History: %v\n", err)
+	}
+}
+
+// Observed lags by model, cycle hour and forecast hour, sorted
+func historyByKey(records []historyRecord) map[historyKey][]float64 {
+	lags := map[historyKey][]float64{}
+	for _, r := range records {
+		k := historyKey{r.Model, r.Cycle.Hour(), r.Forecast}
+		lags[k] = append(lags[k], r.Latency)
+	}
+	for _, l := range lags {
+		sort.Float64s(l)
+	}
+	return lags
+}
+
+// Nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// The learned lag of a forecast hour of the run, if there's enough history
+func learnedLag(run time.Time, forecast int) (time.Duration, bool) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if historyLags == nil {
+		records, err := readHistory(historyPath())
+		if err != nil {
+			log.Printf("History: %v\n", err)
+		}
+		historyLags = historyByKey(records)
+	}
+	lags := historyLags[historyKey{Z.model, run.Hour(), forecast}]
+	if len(lags) < minHistory {
+		return 0, false
+	}
+	return time.Duration(percentile(lags, learnedPercentile)) * time.Second, true
+}
+
+// When the run's first forecast should appear and its last should be done -
+// from history with -learned-lags, otherwise the model's start and end
+func modelLags(run time.Time) (startLag, endLag time.Duration) {
+	startLag, _ = time.ParseDuration(M.start)
+	endLag, _ = time.ParseDuration(M.end)
+	// end is for the usual horizon - stretch it for cycles that go further
+	if horizon, _ := time.ParseDuration(M.horizon); horizon > 0 && runHorizon(run) != horizon {
+		endLag = startLag + time.Duration(float64(endLag-startLag)*float64(runHorizon(run))/float64(horizon))
+	}
+	if !learnedLags {
+		return startLag, endLag
+	}
+	hours := forecastHours(run)
+	if len(hours) == 0 {
+		return startLag, endLag
+	}
+	if lag, ok := learnedLag(run, hours[0]); ok {
+		startLag = lag
+	}
+	if lag, ok := learnedLag(run, hours[len(hours)-1]); ok {
+		endLag = lag
+	}
+	if endLag < startLag {
+		endLag = startLag
+	}
+	return startLag, endLag
+}
+
+// nomads schedule [-model m] - observed lags from the history file
+func scheduleCommand(arguments []string) {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	model := fs.String("model", "", "Only this model")
+	fs.StringVar(&historyFile, "history", "", "History file (default "+defaultHistoryFile()+")")
+	fs.Parse(arguments)
+
+	records, err := readHistory(historyPath())
+	if err != nil {
+		log.Printf("History: %v\n", err)
+		os.Exit(-1)
+	}
+	lags := historyByKey(records)
+	var keys []historyKey
+	for k := range lags {
+		if *model == "" || k.model == *model {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		fmt.Printf("No history in %s\n", historyPath())
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.model != b.model {
+			return a.model < b.model
+		}
+		if a.cycle != b.cycle {
+			return a.cycle < b.cycle
+		}
+		return a.forecast < b.forecast
+	})
+
+	minutes := func(s float64) string { return fmt.Sprintf("%.0fm", s/60) }
+	fmt.Printf("%-16s %5s %5s %5s %6s %6s %6s %6s\n", "model", "cycle", "hour", "n", "p10", "p50", "p90", "max")
+	for _, k := range keys {
+		l := lags[k]
+		fmt.Printf("%-16s %5s %5d %5d %6s %6s %6s %6s\n", k.model, fmt.Sprintf("%02dz", k.cycle), k.forecast, len(l),
+			minutes(percentile(l, 10)), minutes(percentile(l, 50)), minutes(percentile(l, 90)), minutes(l[len(l)-1]))
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import "context"
+import "errors"
+import "fmt"
+import "io"
+import "log"
+import "net/http"
+import "os"
+import "path/filepath"
+import "strconv"
+import "strings"
+import "time"
+
+var fetchTimeout time.Duration
+
+var httpClient = &http.Client{}
+
+// The body ended before the Content-Length the server gave
+var errShortRead = errors.New("short read")
+
+// What came back from an HTTP fetch, successful or not
+type fetchResponse struct {
+	status        int           // HTTP status code, 0 if no response
+	header        http.Header   // Response headers
+	contentLength int64         // Content-Length from the server, -1 if unknown
+	bytes         int64         // Bytes written to the file
+	elapsed       time.Duration // Time from request to last byte
+	body          string        // Start of the body if it wasn't saved (error pages)
+
+	truncated bool // The body stopped short - dropped connection, timeout or short read
+}
+
+// Is it worth trying again? Timeouts, dropped connections (before or part
+// way through the body), short reads, rate limiting and server errors
+// usually clear up; a 404 means the forecast isn't posted.
+func (r fetchResponse) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch {
+	case r.truncated:
+		return true
+	case r.status == 0:
+		return true
+	case r.status == http.StatusTooManyRequests:
+		return true
+	case r.status >= 500:
+		return true
+	}
+	return false
+}
+
+// How long the server asked us to wait, if it said
+func (r fetchResponse) retryAfter() time.Duration {
+	if r.header == nil {
+		return 0
+	}
+	s := r.header.Get("Retry-After")
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "nomads (+https://github.com/lanceberc/nomads)")
+	return req, nil
+}
+
+// Fetch url into fn. The body is streamed to a temporary file in the same
+// directory which is renamed to fn once it's complete, so fn never holds a
+// partial download. Non-200 responses and HTML error pages return an error
+// with the status and the start of the body in the response.
+func fetchUrl(ctx context.Context, url, fn string) (fetchResponse, error) {
+	r := fetchResponse{contentLength: -1}
+	if verbose {
+		log.Printf("GET %s -> %s\n", url, fn)
+	}
+	if fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return r, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		r.elapsed = time.Since(start)
+		return r, err
+	}
+	defer resp.Body.Close()
+	r.status = resp.StatusCode
+	r.header = resp.Header
+	r.contentLength = resp.ContentLength
+
+	if resp.StatusCode != http.StatusOK || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 10240))
+		r.body = string(b)
+		r.elapsed = time.Since(start)
+		if resp.StatusCode == http.StatusOK {
+			return r, fmt.Errorf("%s: error page instead of data", resp.Status)
+		}
+		return r, fmt.Errorf("%s", resp.Status)
+	}
+
+	body := &bodyReader{r: resp.Body}
+	r.bytes, err = saveBody(body, fn, r.contentLength)
+	r.elapsed = time.Since(start)
+	if err != nil {
+		r.truncated = body.err != nil || errors.Is(err, errShortRead)
+		return r, err
+	}
+	if verbose {
+		log.Printf("%s: %s %s in %.1fs\n", filepath.Base(fn), resp.Status, prettyInt(r.bytes), r.elapsed.Seconds())
+	}
+	return r, nil
+}
+
+// A response body that remembers why it stopped, to tell a connection
+// that dropped mid-transfer from a local write error
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// Copy body to a temp file next to fn, then rename it into place if it's
+// the length expected (-1 if not known). A short body never touches fn, so
+// under -merge the forecast already there stays.
+func saveBody(body io.Reader, fn string, length int64) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(fn), filepath.Base(fn)+".*.part")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(tmp, body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && length >= 0 && n != length {
+		err = fmt.Errorf("%w: %d of %d bytes", errShortRead, n, length)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return n, err
+	}
+	if err = os.Rename(tmp.Name(), fn); err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return n, err
+}
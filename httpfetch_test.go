@@ -0,0 +1,133 @@
+package main
+
+import "context"
+import "errors"
+import "fmt"
+import "net/http"
+import "net/http/httptest"
+import "os"
+import "path/filepath"
+import "strings"
+import "testing"
+import "time"
+
+func TestFetchUrl(t *testing.T) {
+	saveTimeout := fetchTimeout
+	defer func() { fetchTimeout = saveTimeout }()
+	grib := []byte("GRIB....7777")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Header().Set("Content-Length", fmt.Sprint(len(grib)))
+			w.Write(grib)
+		case "/busy":
+			w.Header().Set("Retry-After", "7")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			fmt.Fprint(w, "<html><body>Over rate limit</body></html>")
+		case "/short":
+			// The connection drops after half the body
+			w.Header().Set("Content-Length", fmt.Sprint(len(grib)))
+			w.Write(grib[:len(grib)/2])
+		case "/slow":
+			// Half the body, then nothing until the client gives up
+			w.Header().Set("Content-Length", fmt.Sprint(len(grib)))
+			w.Write(grib[:len(grib)/2])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+
+	fn := filepath.Join(dir, "ok.grb2")
+	r, err := fetchUrl(context.Background(), ts.URL+"/ok", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(fn); string(b) != string(grib) || r.status != http.StatusOK || r.bytes != int64(len(grib)) || r.contentLength != int64(len(grib)) {
+		t.Errorf("ok: %+v saved %q", r, b)
+	}
+
+	tests := []struct {
+		path       string
+		status     int
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{"/missing", http.StatusNotFound, false, 0},
+		{"/busy", http.StatusServiceUnavailable, true, 7 * time.Second},
+		{"/html", http.StatusOK, false, 0},
+	}
+	for _, tc := range tests {
+		fn := filepath.Join(dir, tc.path[1:]+".grb2")
+		r, err := fetchUrl(context.Background(), ts.URL+tc.path, fn)
+		if err == nil {
+			t.Errorf("%s: no error", tc.path)
+			continue
+		}
+		if r.status != tc.status || r.retryable(err) != tc.retryable || r.retryAfter() != tc.retryAfter || r.body == "" {
+			t.Errorf("%s: %v status %d retryable %v after %s body %q", tc.path, err, r.status, r.retryable(err), r.retryAfter(), r.body)
+		}
+		if _, err := os.Stat(fn); !os.IsNotExist(err) {
+			t.Errorf("%s: left %s", tc.path, fn)
+		}
+	}
+
+	// A body that stops short is retried and, under -merge, leaves the
+	// forecast already fetched alone
+	fetchTimeout = 200 * time.Millisecond
+	for _, path := range []string{"/short", "/slow"} {
+		fn := filepath.Join(dir, path[1:]+".grb2")
+		if err := os.WriteFile(fn, []byte("good"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := fetchUrl(context.Background(), ts.URL+path, fn)
+		if err == nil || !r.truncated || !r.retryable(err) {
+			t.Errorf("%s: %v truncated %v retryable %v", path, err, r.truncated, r.retryable(err))
+		}
+		if b, _ := os.ReadFile(fn); string(b) != "good" {
+			t.Errorf("%s: replaced the file with %q", path, b)
+		}
+		if parts, _ := filepath.Glob(fn + ".*.part"); len(parts) != 0 {
+			t.Errorf("%s: left %v", path, parts)
+		}
+	}
+	fetchTimeout = saveTimeout
+
+	// Cancelling isn't worth retrying
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r, err := fetchUrl(ctx, ts.URL+"/ok", filepath.Join(dir, "cancelled.grb2")); err == nil || r.retryable(err) {
+		t.Errorf("cancelled: %v retryable %v", err, r.retryable(err))
+	}
+}
+
+func TestSaveBody(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "f006.grb2")
+	if err := os.WriteFile(fn, []byte("good"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := saveBody(strings.NewReader("GRIB"), fn, 12)
+	if !errors.Is(err, errShortRead) || n != 4 {
+		t.Errorf("short: %d %v", n, err)
+	}
+	if b, _ := os.ReadFile(fn); string(b) != "good" {
+		t.Errorf("short: replaced the file with %q", b)
+	}
+
+	for _, length := range []int64{12, -1} {
+		if n, err := saveBody(strings.NewReader("GRIB....7777"), fn, length); err != nil || n != 12 {
+			t.Errorf("length %d: %d %v", length, n, err)
+		}
+		if b, _ := os.ReadFile(fn); string(b) != "GRIB....7777" {
+			t.Errorf("length %d: saved %q", length, b)
+		}
+	}
+	if parts, _ := filepath.Glob(fn + ".*.part"); len(parts) != 0 {
+		t.Errorf("left %v", parts)
+	}
+}
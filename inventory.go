@@ -0,0 +1,133 @@
+package main
+
+import "os"
+import "log"
+import "sort"
+import "strings"
+
+// NOMADS leaves out fields that don't exist for a forecast hour or model
+// without saying so. Compare what each forecast holds with what the zone
+// asked for: a requested variable that shows up at none of the requested
+// levels (or a level with no variables) is missing, and so is a
+// variable/level that other hours of the run have but this one doesn't.
+
+// var:level pairs in a forecast, e.g. UGRD:10_m_above_ground
+type inventory map[string]bool
+
+func fileInventory(fn string) (inventory, map[string]bool, error) {
+	msgs, err := readGrib2File(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	inv := inventory{}
+	statistical := map[string]bool{} // Accumulations etc. aren't in the analysis
+	for _, f := range gribFields(msgs) {
+		key := f.name() + ":" + levelName(f.level1, f.level2)
+		inv[key] = true
+		if !f.endTime.IsZero() {
+			statistical[key] = true
+		}
+	}
+	return inv, statistical, nil
+}
+
+// What the zone asked for that isn't in inv at all
+func (inv inventory) missingRequested() []string {
+	var missing []string
+	allLevels := len(Z.modelLevels) == 1 && Z.modelLevels[0] == "all"
+	allVars := len(Z.modelVars) == 1 && Z.modelVars[0] == "all"
+	levels := map[string]bool{}
+	for _, l := range Z.modelLevels {
+		levels[plainLevel(l)] = true
+	}
+
+	if !allVars {
+		for _, v := range Z.modelVars {
+			if _, known := gribParamIds[v]; !known {
+				continue // Can't tell what it would be called
+			}
+			found := false
+			for key := range inv {
+				name, level, _ := strings.Cut(key, ":")
+				if name == v && (allLevels || levels[level]) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missing = append(missing, v)
+			}
+		}
+	}
+	if !allLevels {
+		for l := range levels {
+			found := false
+			for key := range inv {
+				_, level, _ := strings.Cut(key, ":")
+				if level == l {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missing = append(missing, l)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Check the inventory of every forecast in the run. Forecasts with gaps are
+// reported; if the zone requires all fields they're also deleted and marked
+// bad so -merge fetches them again. Returns the number of forecasts with gaps.
+func verifyInventory() int {
+	invs := make([]inventory, len(results))
+	stats := map[string]bool{}
+	union := inventory{}
+	for i, r := range results {
+		if r.result != "ok" && r.result != "exists" {
+			continue
+		}
+		inv, statistical, err := fileInventory(r.filename)
+		if err != nil {
+			continue // The concatenation reports bad files
+		}
+		invs[i] = inv
+		for key := range inv {
+			union[key] = true
+		}
+		for key := range statistical {
+			stats[key] = true
+		}
+	}
+
+	gaps := 0
+	for i, inv := range invs {
+		if inv == nil {
+			continue
+		}
+		var absent []string
+		for key := range union {
+			if !inv[key] && !(results[i].forecast == 0 && stats[key]) {
+				absent = append(absent, key)
+			}
+		}
+		sort.Strings(absent)
+		missing := append(inv.missingRequested(), absent...)
+		if len(missing) == 0 {
+			continue
+		}
+		gaps++
+		if forecastMembers[i] != "" {
+			log.Printf("%s hour %d missing: %s\n", forecastMembers[i], results[i].forecast, strings.Join(missing, " "))
+		} else {
+			log.Printf("Hour %d missing: %s\n", results[i].forecast, strings.Join(missing, " "))
+		}
+		if Z.requireAllFields {
+			_ = os.Remove(results[i].filename)
+			storeResult(i, results[i].forecast, "bad", "")
+		}
+	}
+	return gaps
+}
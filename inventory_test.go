@@ -0,0 +1,92 @@
+package main
+
+import "os"
+import "fmt"
+import "path/filepath"
+import "reflect"
+import "testing"
+
+func TestLevelName(t *testing.T) {
+	tests := []struct {
+		l1, l2 gribLevel
+		want   string
+	}{
+		{gribLevel{1, 0, 0}, gribLevel{255, 0, 0}, "surface"},
+		{gribLevel{101, 0, 0}, gribLevel{255, 0, 0}, "mean_sea_level"},
+		{gribLevel{103, 0, 10}, gribLevel{255, 0, 0}, "10_m_above_ground"},
+		{gribLevel{103, 0, 0}, gribLevel{103, 0, 1000}, "0-1000_m_above_ground"},
+		{gribLevel{100, 0, 85000}, gribLevel{255, 0, 0}, "850_mb"},
+		{gribLevel{106, 1, 1}, gribLevel{106, 1, 4}, "0.1-0.4_m_below_ground"},
+		{gribLevel{200, 0, 0}, gribLevel{255, 0, 0}, "entire_atmosphere_(considered_as_a_single_layer)"},
+	}
+	for _, tc := range tests {
+		if got := levelName(tc.l1, tc.l2); got != tc.want {
+			t.Errorf("%v %v: %s, want %s", tc.l1, tc.l2, got, tc.want)
+		}
+	}
+	if got := plainLevel("entire_atmosphere_%5C%28considered_as_a_single_layer%5C%29"); got != "entire_atmosphere_(considered_as_a_single_layer)" {
+		t.Errorf("plainLevel: %s", got)
+	}
+}
+
+func TestMissingRequested(t *testing.T) {
+	saveZ := Z
+	defer func() { Z = saveZ }()
+	inv := inventory{"UGRD:10_m_above_ground": true, "VGRD:10_m_above_ground": true, "TMP:2_m_above_ground": true}
+
+	tests := []struct {
+		levels, vars []string
+		want         []string
+	}{
+		{[]string{"10_m_above_ground"}, []string{"UGRD", "VGRD"}, nil},
+		{[]string{"10_m_above_ground", "surface"}, []string{"UGRD", "GUST", "NOTAVAR"}, []string{"GUST", "surface"}},
+		{[]string{"10_m_above_ground"}, []string{"TMP"}, []string{"TMP"}}, // At the wrong level
+		{[]string{"all"}, []string{"TMP"}, nil},
+		{[]string{"2_m_above_ground"}, []string{"all"}, nil},
+	}
+	for _, tc := range tests {
+		Z = Zone{modelLevels: tc.levels, modelVars: tc.vars}
+		if got := inv.missingRequested(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v %v: %v, want %v", tc.levels, tc.vars, got, tc.want)
+		}
+	}
+}
+
+// Hour 1 has an accumulation the analysis can't have; hour 2 lost its VGRD
+func TestVerifyInventory(t *testing.T) {
+	saveZ, saveResults, saveMembers := Z, results, forecastMembers
+	defer func() { Z, results, forecastMembers = saveZ, saveResults, saveMembers }()
+	Z = Zone{modelLevels: []string{"10_m_above_ground"}, modelVars: []string{"UGRD", "VGRD"}, requireAllFields: true}
+
+	wind := func(hour int) [][]byte {
+		return testSections([][]byte{testIdentification(), testGrid(3, 2), testProduct(2, 2, hour)}, testData(6),
+			[][]byte{testProduct(2, 3, hour)}, testData(6))
+	}
+	forecasts := [][]byte{
+		gribMessage(0, wind(0)...),
+		gribMessage(0, testSections(wind(1), [][]byte{testAccumulation(1, 8, 0, 1)}, testData(6))...),
+		gribMessage(0, testSections([][]byte{testIdentification(), testGrid(3, 2), testProduct(2, 2, 2)}, testData(6))...),
+	}
+	dir := t.TempDir()
+	results = make([]result, len(forecasts))
+	forecastMembers = make([]string, len(forecasts))
+	for i, data := range forecasts {
+		fn := filepath.Join(dir, fmt.Sprintf("f%03d.grib2", i))
+		if err := os.WriteFile(fn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		storeResult(i, i, "ok", fn)
+	}
+
+	if gaps := verifyInventory(); gaps != 1 {
+		t.Errorf("%d forecasts with gaps, want 1", gaps)
+	}
+	for i, want := range []string{"ok", "ok", "bad"} {
+		if results[i].result != want {
+			t.Errorf("hour %d: %s, want %s", i, results[i].result, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "f002.grib2")); !os.IsNotExist(err) {
+		t.Error("hour 2 wasn't removed")
+	}
+}
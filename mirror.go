@@ -0,0 +1,235 @@
+package main
+
+import "os"
+import "context"
+import "fmt"
+import "io"
+import "log"
+import "net/http"
+import "path/filepath"
+import "strconv"
+import "strings"
+import "time"
+
+// NOMADS rate-limits hard, but the same files are on public object-storage
+// mirrors with a wgrib2-style .idx inventory next to each one:
+//
+//   1:0:d=2024032512:REFC:entire atmosphere:anl:
+//   2:361734:d=2024032512:RETOP:cloud top:anl:
+//
+// Reading the .idx tells us which byte ranges hold the zone's variables and
+// levels so only those are downloaded. The mirrors return full-domain fields.
+
+var source string
+
+// A message in a .idx inventory
+type idxEntry struct {
+	start int64
+	end   int64 // Last byte, -1 for the rest of the file
+	name  string
+	level string // NOMADS-style, 10_m_above_ground
+}
+
+// Which source to use for the model - the -source flag wins
+func modelSource() string {
+	if source != "" {
+		return source
+	}
+	if M.source != "" {
+		return M.source
+	}
+	return "nomads"
+}
+
+func parseIdx(data []byte) ([]idxEntry, error) {
+	var entries []idxEntry
+	for n, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 6 {
+			return nil, fmt.Errorf("idx line %d: too few fields", n+1)
+		}
+		start, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("idx line %d: bad offset %q", n+1, fields[1])
+		}
+		entries = append(entries, idxEntry{start: start, end: -1, name: fields[3], level: strings.ReplaceAll(fields[4], " ", "_")})
+	}
+	// A message ends where the next one starts. Fields sharing a message
+	// (1.1, 1.2) share an offset and so its range.
+	for i := len(entries) - 2; i >= 0; i-- {
+		if entries[i+1].start == entries[i].start {
+			entries[i].end = entries[i+1].end
+		} else {
+			entries[i].end = entries[i+1].start - 1
+		}
+	}
+	return entries, nil
+}
+
+// The idx entries the zone asks for
+func selectIdx(entries []idxEntry) []idxEntry {
+	allLevels := len(Z.modelLevels) == 1 && Z.modelLevels[0] == "all"
+	allVars := len(Z.modelVars) == 1 && Z.modelVars[0] == "all"
+	levels := map[string]bool{}
+	for _, l := range Z.modelLevels {
+		levels[plainLevel(l)] = true
+	}
+	vars := map[string]bool{}
+	for _, v := range Z.modelVars {
+		vars[v] = true
+	}
+
+	var selected []idxEntry
+	for _, e := range entries {
+		if (allVars || vars[e.name]) && (allLevels || levels[e.level]) {
+			selected = append(selected, e)
+		}
+	}
+	return selected
+}
+
+// Merge adjacent messages, and fields of the same message, so they come
+// down once in one request
+func coalesceRanges(entries []idxEntry) []idxEntry {
+	var spans []idxEntry
+	for _, e := range entries {
+		if n := len(spans); n > 0 && (spans[n-1].end < 0 || e.start <= spans[n-1].end) {
+			continue // Already in the span
+		}
+		if n := len(spans); n > 0 && spans[n-1].end >= 0 && spans[n-1].end+1 == e.start {
+			spans[n-1].end = e.end
+			continue
+		}
+		spans = append(spans, e)
+	}
+	return spans
+}
+
+// Fetch the whole of a small file, e.g. an .idx
+func fetchBytes(ctx context.Context, url string) (fetchResponse, []byte, error) {
+	r := fetchResponse{contentLength: -1}
+	if fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return r, nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return r, nil, err
+	}
+	defer resp.Body.Close()
+	r.status = resp.StatusCode
+	r.header = resp.Header
+	r.contentLength = resp.ContentLength
+	data, err := io.ReadAll(resp.Body)
+	r.bytes = int64(len(data))
+	r.elapsed = time.Since(start)
+	if err != nil {
+		r.truncated = true
+		return r, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return r, nil, fmt.Errorf("%s", resp.Status)
+	}
+	return r, data, nil
+}
+
+// Download the zone's messages from a mirror into fn using the .idx
+func fetchFromMirror(ctx context.Context, url, fn string) (fetchResponse, error) {
+	r, data, err := fetchBytes(ctx, url+".idx")
+	if err != nil {
+		return r, fmt.Errorf("idx: %v", err)
+	}
+	entries, err := parseIdx(data)
+	if err != nil {
+		return r, err
+	}
+	selected := selectIdx(entries)
+	if len(selected) == 0 {
+		return r, fmt.Errorf("no matching fields in %d idx entries", len(entries))
+	}
+	spans := coalesceRanges(selected)
+	if verbose {
+		log.Printf("%s: %d of %d fields in %d ranges\n", filepath.Base(fn), len(selected), len(entries), len(spans))
+	}
+
+	start := time.Now()
+	tmp, err := os.CreateTemp(filepath.Dir(fn), filepath.Base(fn)+".*.part")
+	if err != nil {
+		return r, err
+	}
+	var total int64
+	for _, span := range spans {
+		sr, err := fetchRange(ctx, url, span, tmp)
+		total += sr.bytes
+		if err != nil {
+			tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return sr, err
+		}
+		r = sr
+	}
+	if err = tmp.Close(); err == nil {
+		err = os.Rename(tmp.Name(), fn)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return r, err
+	}
+	r.bytes = total
+	r.contentLength = total
+	r.elapsed = time.Since(start)
+	if verbose {
+		log.Printf("%s: %s in %.1fs\n", filepath.Base(fn), prettyInt(r.bytes), r.elapsed.Seconds())
+	}
+	return r, nil
+}
+
+// One HTTP Range request appended to out
+func fetchRange(ctx context.Context, url string, span idxEntry, out io.Writer) (fetchResponse, error) {
+	r := fetchResponse{contentLength: -1}
+	if fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return r, err
+	}
+	if span.end >= 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", span.start, span.end))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", span.start))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return r, err
+	}
+	defer resp.Body.Close()
+	r.status = resp.StatusCode
+	r.header = resp.Header
+	r.contentLength = resp.ContentLength
+	if resp.StatusCode != http.StatusPartialContent {
+		// A 200 would be the whole file - not what we asked for
+		return r, fmt.Errorf("range %d-%d: %s", span.start, span.end, resp.Status)
+	}
+	body := &bodyReader{r: resp.Body}
+	r.bytes, err = io.Copy(out, body)
+	r.elapsed = time.Since(start)
+	r.truncated = body.err != nil
+	if err == nil && r.contentLength >= 0 && r.bytes != r.contentLength {
+		r.truncated = true
+		err = fmt.Errorf("range %d-%d: short read %d of %d bytes", span.start, span.end, r.bytes, r.contentLength)
+	}
+	return r, err
+}
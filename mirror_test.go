@@ -0,0 +1,94 @@
+package main
+
+import "reflect"
+import "testing"
+
+// HRRR-style inventory: UGRD and VGRD share message 2
+const testIdx = `1:0:d=2026070612:REFC:entire atmosphere:6 hour fcst:
+2.1:1000:d=2026070612:UGRD:10 m above ground:6 hour fcst:
+2.2:1000:d=2026070612:VGRD:10 m above ground:6 hour fcst:
+3:2500:d=2026070612:TMP:2 m above ground:6 hour fcst:
+4:4000:d=2026070612:GUST:surface:6 hour fcst:
+`
+
+func TestParseIdx(t *testing.T) {
+	entries, err := parseIdx([]byte(testIdx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []idxEntry{
+		{0, 999, "REFC", "entire_atmosphere"},
+		{1000, 2499, "UGRD", "10_m_above_ground"},
+		{1000, 2499, "VGRD", "10_m_above_ground"},
+		{2500, 3999, "TMP", "2_m_above_ground"},
+		{4000, -1, "GUST", "surface"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %v\nwant %v", entries, want)
+	}
+
+	for _, bad := range []string{"1:0:d=2026070612:REFC\n", "1:x:d=2026070612:REFC:entire atmosphere:anl:\n"} {
+		if _, err := parseIdx([]byte(bad)); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestSelectIdx(t *testing.T) {
+	saveZ := Z
+	defer func() { Z = saveZ }()
+	entries, err := parseIdx([]byte(testIdx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		levels, vars []string
+		want         []string
+	}{
+		{[]string{"10_m_above_ground"}, []string{"UGRD", "VGRD", "TMP"}, []string{"UGRD", "VGRD"}},
+		{[]string{"surface", "2_m_above_ground"}, []string{"all"}, []string{"TMP", "GUST"}},
+		{[]string{"all"}, []string{"REFC"}, []string{"REFC"}},
+		{[]string{"entire_atmosphere"}, []string{"TMP"}, nil},
+	}
+	for _, tc := range tests {
+		Z = Zone{modelLevels: tc.levels, modelVars: tc.vars}
+		var got []string
+		for _, e := range selectIdx(entries) {
+			got = append(got, e.name)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v %v: %v, want %v", tc.levels, tc.vars, got, tc.want)
+		}
+	}
+}
+
+func TestCoalesceRanges(t *testing.T) {
+	entries, err := parseIdx([]byte(testIdx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		selected []int
+		want     [][2]int64
+	}{
+		{"second field of a message", []int{2}, [][2]int64{{1000, 2499}}},
+		{"both fields of a message", []int{1, 2}, [][2]int64{{1000, 2499}}},
+		{"adjacent", []int{0, 2, 3}, [][2]int64{{0, 3999}}},
+		{"gap", []int{0, 3}, [][2]int64{{0, 999}, {2500, 3999}}},
+		{"to the end", []int{1, 2, 4}, [][2]int64{{1000, 2499}, {4000, -1}}},
+	}
+	for _, tc := range tests {
+		var selected []idxEntry
+		for _, n := range tc.selected {
+			selected = append(selected, entries[n])
+		}
+		var got [][2]int64
+		for _, s := range coalesceRanges(selected) {
+			got = append(got, [2]int64{s.start, s.end})
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -2,15 +2,17 @@ package main
 
 import "os"
 import "os/user"
-import "os/exec"
-import "syscall"
+import "context"
+import "net/http"
+import "os/signal"
 import "sync"
 import "time"
-import "io"
 import "fmt"
 import "flag"
 import "log"
+import "errors"
 import "sort"
+import "strings"
 
 type Longitude struct{ west, east float64 }
 type Latitude struct{ north, south float64 }
@@ -23,11 +25,30 @@ type Zone struct {
 	latitude    Latitude
 	modelLevels []string
 	modelVars   []string
+
+	requireAllFields bool   // Treat forecasts missing requested fields as bad so -merge refetches them
+	regrid           Regrid // Resample onto a regular lat/lon grid before writing the composite
+	earthWinds       bool   // Rotate grid-relative U/V to earth-relative in the composite
+	deriveWinds      bool   // Add WIND and WDIR computed from U/V
+	gustFactor       bool   // With deriveWinds, add the gust factor (local GUSTF) computed from GUST
+
+	storm    string  // Per-storm models (HAFS): storm ID or name, empty if only one is active
+	stormBox float64 // Degrees either side of the storm centre, 0 to use longitude & latitude
+
+	members   []string // Ensemble members instead of the model's fn: gec00, gep01-gep30, gespr, all
+	perMember bool     // One composite per member rather than one with them all
+
+	ensembleStats bool      // Write the members' wind mean, spread and exceedance probabilities
+	thresholds    []float64 // Exceedance thresholds in knots
+
+	blend []string // Component zones, highest resolution first - see blend.go
+
+	points []Point // Named points for the point command
 }
 
 var zones = map[string]Zone{
 	"sf": Zone{
-		description: "SF Bay Wind hi-res (18 hour hrrr)",
+		description: "SF Bay Wind hi-res (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "sf",
 		model:       "hrrr",
 		longitude:   Longitude{-122.5, -121.0},
@@ -36,9 +57,11 @@ var zones = map[string]Zone{
 		// modelVars:   []string{"PRES", "UGRD", "VGRD", "TMP", "WIND", "GUST"},
 		modelLevels: []string{"mean_sea_level", "surface", "1_m_above_ground", "2_m_above_ground", "10_m_above_ground", "entire_atmosphere", "entire_atmosphere_%5C%28considered_as_a_single_layer%5C%29"},
 		modelVars:   []string{"APCP", "GUST", "PRATE", "PRES", "PWAT", "TMP", "UGRD", "VGRD", "WIND", "REFC", "REFD", "MAXREF", "CAPE", "LFTX", "LTNG", "VIS", "MSLMA"},
+
+		points: []Point{{"Golden Gate", 37.8199, -122.4783}, {"Alcatraz", 37.8267, -122.4230}, {"Berkeley Circle", 37.8650, -122.3450}},
 	},
 	"socal": Zone{
-		description: "SoCal Bay Wind hi-res (18 hour hrrr)",
+		description: "SoCal Bay Wind hi-res (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "socal",
 		model:       "hrrr",
 		longitude:   Longitude{-120.5, -116.5},
@@ -49,7 +72,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"APCP", "GUST", "PRATE", "PRES", "PWAT", "TMP", "UGRD", "VGRD", "WIND", "REFC", "REFD", "MAXREF", "MSLMA"},
 	},
 	"socal+": Zone{
-		description: "SoCal Bay Wind hi-res (18 hour hrrr)",
+		description: "SoCal Bay Wind hi-res (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "socal",
 		model:       "hrrr",
 		longitude:   Longitude{-120.5, -116.5},
@@ -60,7 +83,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"APCP", "GUST", "PRATE", "PRES", "PWAT", "TMP", "UGRD", "VGRD", "WIND", "REFC", "REFD", "MAXREF", "CAPE", "LFTX", "LTNG", "VIS", "MSLMA"},
 	},
 	"socal36+": Zone{
-		description: "SoCal Bay Wind hi-res (18 hour hrrr)",
+		description: "SoCal Bay Wind hi-res (48 hour hrrr, runs every 6 hours)",
 		geo:         "socal",
 		model:       "hrrr36",
 		longitude:   Longitude{-120.5, -116.5},
@@ -71,7 +94,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"APCP", "GUST", "PRATE", "PRES", "PWAT", "TMP", "UGRD", "VGRD", "WIND", "REFC", "REFD", "MAXREF", "CAPE", "LFTX", "LTNG", "VIS", "MSLMA"},
 	},
 	"sf36": Zone{
-		description: "SF Bay Wind hi-res (36 hour hrrr, runs every 6 hours)",
+		description: "SF Bay Wind hi-res (48 hour hrrr, runs every 6 hours)",
 		geo:         "sf",
 		model:       "hrrr36",
 		longitude:   Longitude{-123, -122},
@@ -80,7 +103,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"PRES", "UGRD", "VGRD", "TMP", "WIND", "GUST", "MSLMA"},
 	},
 	"sf36+": Zone{
-		description: "SF Bay Wind hi-res (36 hour hrrr, runs every 6 hours)",
+		description: "SF Bay Wind hi-res (48 hour hrrr, runs every 6 hours)",
 		geo:         "sf",
 		model:       "hrrr36",
 		longitude:   Longitude{-123, -122},
@@ -89,16 +112,16 @@ var zones = map[string]Zone{
 		modelVars:   []string{"APCP", "GUST", "PRATE", "PRES", "PWAT", "TMP", "UGRD", "VGRD", "WIND", "REFC", "REFD", "MAXREF", "CAPE", "LFTX", "LTNG", "VIS", "MSLMA"},
 	},
 	"sfoffshore": Zone{
-		description: "SF Bay & Farallones Wind hi-res (18 hour hrrr)",
-		geo:         "hrrr",
-		model:       "sfoffshore",
+		description: "SF Bay & Farallones Wind hi-res (18 hour hrrr, 48 on synoptic runs)",
+		geo:         "sfoffshore",
+		model:       "hrrr",
 		longitude:   Longitude{-131, -119},
 		latitude:    Latitude{41, 35},
 		modelLevels: []string{"surface", "2_m_above_ground", "10_m_above_ground"},
 		modelVars:   []string{"PRES", "UGRD", "VGRD", "TMP", "WIND", "GUST", "MSLMA"},
 	},
 	"sfoffshore36": Zone{
-		description: "SF Bay & Farallones Wind hi-res (36 hour hrrr)",
+		description: "SF Bay & Farallones Wind hi-res (48 hour hrrr)",
 		geo:         "sfoffshore",
 		model:       "hrrr36",
 		longitude:   Longitude{-131, -119},
@@ -124,8 +147,18 @@ var zones = map[string]Zone{
 		modelLevels: []string{"surface", "2_m_above_ground", "10_m_above_ground", "1000_m_above_ground", "4000_m_above_ground", "entire_atmosphere"},
 		modelVars:   []string{"UGRD", "VGRD", "TMP", "WIND", "GUST", "MSLMA"},
 	},
+	"sf-ll": Zone{
+		description: "SF Bay Wind hi-res on a lat/lon grid (18 hour hrrr, 48 on synoptic runs)",
+		geo:         "sf",
+		model:       "hrrr",
+		longitude:   Longitude{-123, -122},
+		latitude:    Latitude{38, 37},
+		modelLevels: []string{"surface", "2_m_above_ground", "10_m_above_ground"},
+		modelVars:   []string{"PRES", "UGRD", "VGRD", "TMP", "WIND", "GUST", "MSLMA"},
+		regrid:      Regrid{0.025, "bilinear"},
+	},
 	"norcal": Zone{
-		description: "Bay Area (incl Monterey Bay) all variables (18 hour hrrr)",
+		description: "Bay Area (incl Monterey Bay) all variables (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "norcal",
 		model:       "hrrr",
 		longitude:   Longitude{-123, -121},
@@ -144,6 +177,14 @@ var zones = map[string]Zone{
 		//modelLevels: []string{"mean_sea_level", "surface", "2_m_above_ground", "10_m_above_ground"},
 		//modelVars:   []string{"PRMSL", "MSLET", "UGRD", "VGRD", "TMP", "GUST"},
 	},
+	"sf-blend": Zone{
+		description: "SF Bay & outside, HRRR then NAM nest then GFS (4 days, blended)",
+		geo:         "sfblend",
+		longitude:   Longitude{-124.5, -121.0},
+		latitude:    Latitude{39.0, 36.5},
+		regrid:      Regrid{0.03, "bilinear"},
+		blend:       []string{"sf", "sfnam", "sf96"},
+	},
 	"sfnam": Zone{
 		description: "Outside SF Bay Wind (60 hour NAM)",
 		geo:         "sfnam",
@@ -218,7 +259,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"PRMSL", "UGRD", "VGRD", "TMP", "GUST", "LTNG", "PWAT", "CSNOW", "CICEP", "CFRZR", "CRAIN", "REFC", "PRATE", "NCPCP" },
 	},
 	"cahrrr": Zone{
-		description: "California Coast (18 hour HRRR)",
+		description: "California Coast (18 hour HRRR, 48 on synoptic runs)",
 		geo:         "ca",
 		model:       "hrrr",
 		longitude:   Longitude{-130.0, -116.0},
@@ -227,7 +268,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"APCP", "GUST", "PRATE", "PRES", "PWAT", "TMP", "UGRD", "VGRD", "WIND", "REFC", "REFD", "MAXREF", "LTNG", "MSLMA" },
 	},
 	"cahrrr36": Zone{
-		description: "California Coast (36 hour HRRR)",
+		description: "California Coast (48 hour HRRR)",
 		geo:         "ca",
 		model:       "hrrr36",
 		longitude:   Longitude{-130.0, -116.0},
@@ -245,7 +286,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"PRES", "UGRD", "VGRD", "TMP", "WIND", "GUST", "MSLMA"},
 	},
 	"tahoe": Zone{
-		description: "Tahoe area (18 hour hrrr)",
+		description: "Tahoe area (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "tahoe",
 		model:       "hrrr",
 		longitude:   Longitude{-123, -119},
@@ -264,7 +305,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"PRMSL", "MSLET", "PWAT", "UGRD", "VGRD", "TMP", "GUST", "PRATE", "REFC", "REFD", "MAXREF", "APCP", "SNOD", "WEASD", "SRWEQ", "CFRZR", "CICE", "CICEP", "CPOFP", "CRAIN", "CSNOW", "SNOD" },
 	},
 	"co": Zone{
-		description: "Colorado (18 hour hrrr)",
+		description: "Colorado (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "co",
 		model:       "hrrr",
 		longitude:   Longitude{-109.0, -102.0},
@@ -341,6 +382,18 @@ var zones = map[string]Zone{
 		//modelLevels: []string{"mean_sea_level", "surface", "2_m_above_ground", "10_m_above_ground"},
 		//modelVars:   []string{"PRMSL", "MSLET", "UGRD", "VGRD", "GUST", "PRES"},
 	},
+	"paccup-ens": Zone{
+		description: "Pacific Cup GEFS members (16 day, control + 30 perturbations in one file)",
+		geo:         "paccup",
+		model:       "gfs-ensemble-25",
+		longitude:   Longitude{-160, -115},
+		latitude:    Latitude{50, 15},
+		members:     []string{"all"},
+		modelLevels: []string{"mean_sea_level", "10_m_above_ground"},
+		modelVars:   []string{"PRMSL", "UGRD", "VGRD"},
+
+		ensembleStats: true,
+	},
 	"paccup-wave": Zone{
 		description: "Pacific Cup Wave (15 day GFS)",
 		geo:         "paccup",
@@ -350,6 +403,24 @@ var zones = map[string]Zone{
 		modelLevels: []string{"surface", "1_in_sequence", "2_in_sequence", "3_in_sequence" },
 		modelVars:   []string{"DIRPW", "HTSGW", "PERPW", "SWDIR", "SWELL", "SWPER", "WVDIR", "WVHGT", "WVPER", },
 	},
+	"paccup-current": Zone{
+		description: "Pacific Cup Currents & SST (8 day RTOFS)",
+		geo:         "paccup",
+		model:       "rtofs",
+		longitude:   Longitude{-160, -115},
+		latitude:    Latitude{50, 15},
+		modelLevels: []string{"0_m_below_sea_level"},
+		modelVars:   []string{"UOGRD", "VOGRD", "WTMP"},
+	},
+	"pacific-current": Zone{
+		description: "North-East Pacific Currents & SST (8 day RTOFS)",
+		geo:         "pacific",
+		model:       "rtofs",
+		longitude:   Longitude{-230, -100},
+		latitude:    Latitude{70, 10},
+		modelLevels: []string{"0_m_below_sea_level"},
+		modelVars:   []string{"UOGRD", "VOGRD", "WTMP"},
+	},
 	"ca-wave": Zone{
 		description: "Pacific Cup Wave (15 day GFS)",
 		geo:         "ca",
@@ -412,7 +483,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"PRMSL", "MSLET", "UGRD", "VGRD", "TMP", "APCP", "PWAT", "PRATE", "GUST", "HGT", "REFC"},
 	},
 	"la": Zone{
-		description: "Los Angeles Wind hi-res (18 hour hrrr)",
+		description: "Los Angeles Wind hi-res (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "la",
 		model:       "hrrr",
 		longitude:   Longitude{-122.0, -117.0},
@@ -459,7 +530,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"APCP", "GUST", "PRATE", "PRES", "PWAT", "TMP", "UGRD", "VGRD", "WIND", "MSLMA"},
 	},
 	"chessy": Zone{
-		description: "Annapolis Wind hi-res (18 hour hrrr)",
+		description: "Annapolis Wind hi-res (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "chesapeake",
 		model:       "hrrr",
 		longitude:   Longitude{-77.0, -75.5},
@@ -468,7 +539,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"PRES", "UGRD", "VGRD", "TMP", "WIND", "GUST", "MSLMA"},
 	},
 	"newport": Zone{
-		description: "Newport Wind hi-res (18 hour hrrr)",
+		description: "Newport Wind hi-res (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "newport",
 		model:       "hrrr",
 		longitude:   Longitude{-71.5, -71.0},
@@ -477,7 +548,7 @@ var zones = map[string]Zone{
 		modelVars:   []string{"PRES", "UGRD", "VGRD", "TMP", "WIND", "GUST", "MSLMA"},
 	},
 	"hamptons": Zone{
-		description: "Hamptons to Newport Wind hi-res (18 hour hrrr)",
+		description: "Hamptons to Newport Wind hi-res (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "hamptons",
 		model:       "hrrr",
 		longitude:   Longitude{-72.5, -71.0},
@@ -535,7 +606,7 @@ var zones = map[string]Zone{
 		//modelVars:   []string{"PRMSL", "MSLET", "UGRD", "VGRD", "TMP", "ACPCP", "CPRAT", "APCP", "PWAT", "PRATE", "GUST", "HGT", "REFC", "CAPE", "CRAIN", "CSNOW", "CICEP", "CFRZR", "CPOFP", "GRLE", "ICMR", "WEASD"},
 	},
 	"chihrrr": Zone{
-		description: "Chicago HRRR hi-res (18 hour hrrr)",
+		description: "Chicago HRRR hi-res (18 hour hrrr, 48 on synoptic runs)",
 		geo:         "chicago",
 		model:       "hrrr",
 		longitude:   Longitude{-96, -82},
@@ -565,6 +636,68 @@ var zones = map[string]Zone{
 		modelVars:   []string{"PRMSL", "MSLET", "UGRD", "VGRD", "TMP", "ACPCP", "CPRAT", "APCP", "PWAT", "PRATE", "GUST", "HGT", "REFC", "CAPE", "CRAIN", "CSNOW", "CICEP", "CFRZR", "CPOFP", "GRLE", "ICMR", "WEASD", "RH", "HCDC", "MCDC", "LCDC", "TCDC"},
 		//modelVars:   []string{"PRMSL", "MSLET", "UGRD", "VGRD", "TMP", "ACPCP", "CPRAT", "APCP", "PWAT", "PRATE", "GUST", "HGT", "REFC", "CAPE", "CRAIN", "CSNOW", "CICEP", "CFRZR", "CPOFP", "GRLE", "ICMR", "WEASD"},
 	},
+	"sfrap": Zone{
+		description: "SF Bay Wind (21 hour RAP, 51 hours every 6)",
+		geo:         "sf",
+		model:       "rap",
+		longitude:   Longitude{-124.5, -121.0},
+		latitude:    Latitude{39.0, 36.0},
+		modelLevels: []string{"mean_sea_level", "surface", "2_m_above_ground", "10_m_above_ground", "entire_atmosphere"},
+		modelVars:   []string{"MSLMA", "PRES", "UGRD", "VGRD", "GUST", "TMP", "APCP", "PRATE", "CAPE", "REFC"},
+	},
+	"paccuprap": Zone{
+		description: "Pacific Cup coast Wind (21 hour RAP 32km)",
+		geo:         "paccup",
+		model:       "rap32",
+		longitude:   Longitude{-140, -118},
+		latitude:    Latitude{45, 28},
+		modelLevels: []string{"mean_sea_level", "surface", "2_m_above_ground", "10_m_above_ground"},
+		modelVars:   []string{"MSLMA", "PRES", "UGRD", "VGRD", "GUST", "TMP", "APCP", "PRATE"},
+	},
+	"sfnbm": Zone{
+		description: "SF Bay National Blend of Models (36 hours, 11 days every 6)",
+		geo:         "sf",
+		model:       "nbm",
+		longitude:   Longitude{-123.5, -121.0},
+		latitude:    Latitude{39.0, 36.5},
+		modelLevels: []string{"surface", "2_m_above_ground", "10_m_above_ground"},
+		modelVars:   []string{"WIND", "WDIR", "GUST", "TMP", "DPT", "TCDC", "APCP", "VIS"},
+	},
+	"canam12": Zone{
+		description: "California NAM 12km (84 hour NAM)",
+		geo:         "ca",
+		model:       "nam",
+		longitude:   Longitude{-126, -114},
+		latitude:    Latitude{42, 32},
+		modelLevels: []string{"mean_sea_level", "surface", "2_m_above_ground", "10_m_above_ground"},
+		modelVars:   []string{"PRMSL", "MSLET", "UGRD", "VGRD", "TMP", "GUST", "PRES", "APCP", "PRATE", "CAPE", "REFC"},
+	},
+	"chi-wave": Zone{
+		description: "Lake Michigan Wave (Great Lakes GLWU)",
+		geo:         "chicago",
+		model:       "glwu",
+		longitude:   Longitude{-96, -82},
+		latitude:    Latitude{45, 38},
+		modelLevels: []string{"all"},
+		modelVars:   []string{"all"},
+	},
+	"hafs": Zone{
+		description: "Hurricane wind/rain (5 day HAFS storm nest, 5 degrees around the storm - choose with -storm)",
+		geo:         "hafs",
+		model:       "hafs-storm",
+		stormBox:    5,
+		modelLevels: []string{"mean_sea_level", "surface", "10_m_above_ground"},
+		modelVars:   []string{"PRMSL", "UGRD", "VGRD", "GUST", "APCP", "PRATE", "REFC"},
+	},
+	"hafs-florida": Zone{
+		description: "Florida & Bahamas hurricane wind (5 day HAFS parent grid - choose with -storm)",
+		geo:         "hafs-florida",
+		model:       "hafs-parent",
+		longitude:   Longitude{-88, -72},
+		latitude:    Latitude{32, 22},
+		modelLevels: []string{"mean_sea_level", "surface", "10_m_above_ground"},
+		modelVars:   []string{"PRMSL", "UGRD", "VGRD", "GUST", "APCP", "PRATE"},
+	},
 }
 
 type Model struct {
@@ -574,21 +707,32 @@ type Model struct {
 	horizon           string // Hours to last forecast in model run
 	start             string // How long after the run starts the first forecast is usually available
 	end               string // How long after the run starts the last forecast is usually avaialable
-	baseurl           string // The URL with some fields to fill in
-	baseurlfn         string // The filename associated with the forecast step URL
+	baseurl           string // The filter URL, a template (see urls.go)
+	baseurlfn         string // The filename associated with the forecast step URL, a template
+	mirrorurl         string // Full GRIB on a cloud mirror with a .idx beside it, a template
+	source            string // "nomads" (default) or "mirror"
+	probeurl          string // Full GRIB on the NOMADS server, to see if a run is posted, a template
+	steps             []Step         // Forecast steps if they aren't forecastFrequency all the way to the horizon
+	horizons          map[int]string // Horizon for cycle hours that go further (or not as far) as horizon
+	stormurl          string         // Models run per storm: tcvitals listing the cycle's storms, a template
 }
 
+// Forecasts every step hours from from to to, inclusive
+type Step struct{ from, to, step string }
+
 var models = map[string]Model{
 	"gfs": {
 		fn:                "gfs",  // filename for GRIB
 		modelFrequency:    "6h",   // How often model runs (assume all models run at 00z)
-		forecastFrequency: "6h",   // Time between forecasts
+		forecastFrequency: "6h",   // Time between forecasts - every 6 hours of the hourly to 120h then 3 hourly files; gfs_hourly fetches them all
 		horizon:           "384h", // When is last forecast?
 		start:             "3.5h", // How long after run first forecast usually appears
 		end:               "5h",   // How long after run last forecast usually appears
 		// baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfs_0p25.pl?file=%s%s%s&subregion=&leftlon=%05.2f&rightlon=%05.2f&toplat=%05.2f&bottomlat=%05.2f&dir=%%2Fgfs.%04d%02d%02d%%2F%02d",
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfs_0p25.pl?file=%s%s%s&subregion=&leftlon=%05.2f&rightlon=%05.2f&toplat=%05.2f&bottomlat=%05.2f&dir=%%2Fgfs.%04d%02d%02d%%2F%02d%%2Fatmos",
-		baseurlfn:         "%s.t%02dz.pgrb2.0p25.f%03d",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfs_0p25.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fgfs.{{.Date}}%2F{{.Cycle}}%2Fatmos",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.pgrb2.0p25.f{{pad 3 .FHour}}",
+		mirrorurl:         "https://noaa-gfs-bdp-pds.s3.amazonaws.com/gfs.{{.Date}}/{{.Cycle}}/atmos/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gfs/prod/gfs.{{.Date}}/{{.Cycle}}/atmos/{{.File}}",
 	},
 	"gfs-wave-global": {
 		fn:                "gfswave",  // filename for GRIB
@@ -599,31 +743,39 @@ var models = map[string]Model{
 		end:               "5.25h",   // How long after run last forecast usually appears
 		// baseurl:           "?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fgfs.%04d%02d%02d%%2F%02d",
 		// https://nomads.ncep.noaa.gov/cgi-bin/filter_gfswave.pl?dir=%2Fgfs.20240325%2F18%2Fwave%2Fgridded&file=gfswave.t18z.epacif.0p16.f000.grib2&all_var=on&all_lev=on
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfswave.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fgfs.%04d%02d%02d%%2F%02d%%2Fwave%%2Fgridded",
-		baseurlfn:         "%s.t%02dz.global.0p16.f%03d.grib2",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfswave.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fgfs.{{.Date}}%2F{{.Cycle}}%2Fwave%2Fgridded",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.global.0p16.f{{pad 3 .FHour}}.grib2",
+		mirrorurl:         "https://noaa-gfs-bdp-pds.s3.amazonaws.com/gfs.{{.Date}}/{{.Cycle}}/wave/gridded/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gfs/prod/gfs.{{.Date}}/{{.Cycle}}/wave/gridded/{{.File}}",
 	},
 	"gfs-wave-epacif": {
 		fn:                "gfswave",  // filename for GRIB
 		modelFrequency:    "6h",   // How often model runs (assume all models run at 00z)
 		forecastFrequency: "1h",   // Time between forecasts // Hourly for 120 hours, every 3 until 384
 		horizon:           "384h", // When is last forecast?
+		steps:             []Step{{"0h", "120h", "1h"}, {"123h", "384h", "3h"}},
 		start:             "3.5h", // How long after run first forecast usually appears
 		end:               "5.25h",   // How long after run last forecast usually appears
 		// baseurl:           "?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fgfs.%04d%02d%02d%%2F%02d",
 		// https://nomads.ncep.noaa.gov/cgi-bin/filter_gfswave.pl?dir=%2Fgfs.20240325%2F18%2Fwave%2Fgridded&file=gfswave.t18z.epacif.0p16.f000.grib2&all_var=on&all_lev=on
 		// https://nomads.ncep.noaa.gov/cgi-bin/filter_gfswave.pl?file=gfswave.t12z.epacif.0p16.f177.grib2&all_lev=on&all_var=on&leftlon=0&rightlon=360&toplat=90&bottomlat=-90&dir=%2Fgfs.20240604%2F12%2Fwave%2Fgridded
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfswave.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fgfs.%04d%02d%02d%%2F%02d%%2Fwave%%2Fgridded",
-		baseurlfn:         "%s.t%02dz.epacif.0p16.f%03d.grib2",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfswave.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fgfs.{{.Date}}%2F{{.Cycle}}%2Fwave%2Fgridded",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.epacif.0p16.f{{pad 3 .FHour}}.grib2",
+		mirrorurl:         "https://noaa-gfs-bdp-pds.s3.amazonaws.com/gfs.{{.Date}}/{{.Cycle}}/wave/gridded/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gfs/prod/gfs.{{.Date}}/{{.Cycle}}/wave/gridded/{{.File}}",
 	},
 	"gfs_hourly": {
 		fn:                "gfs",
 		modelFrequency:    "6h",
 		forecastFrequency: "1h",
 		horizon:           "384h",
+		steps:             []Step{{"0h", "120h", "1h"}, {"123h", "384h", "3h"}}, // Hourly for 5 days then every 3 hours
 		start:             "3.5h", // gfs forecasts show up about 3 1/2  hours after model run
 		end:               "5h",   // gfs 384 hour forecast completes about five hours after model run
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfs_0p25_1hr.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fgfs.%04d%02d%02d%%2F%02d",
-		baseurlfn:         "%s.t%02dz.pgrb2.0p25.f%03d",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gfs_0p25_1hr.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fgfs.{{.Date}}%2F{{.Cycle}}",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.pgrb2.0p25.f{{pad 3 .FHour}}",
+		mirrorurl:         "https://noaa-gfs-bdp-pds.s3.amazonaws.com/gfs.{{.Date}}/{{.Cycle}}/atmos/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gfs/prod/gfs.{{.Date}}/{{.Cycle}}/atmos/{{.File}}",
 	},
 	"gfs-ensemble-25": {
 		fn:                "geavg",  // filename for GRIB
@@ -632,8 +784,10 @@ var models = map[string]Model{
 		horizon:           "384h", // When is last forecast?
 		start:             "3.75h", // How long after run first forecast usually appears
 		end:               "6.5h",   // How long after run last forecast usually appears
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gefs_atmos_0p25s.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fgefs.%04d%02d%02d%%2F%02d%%2Fatmos%%2Fpgrb2sp25",
-		baseurlfn:         "%s.t%02dz.pgrb2s.0p25.f%03d",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gefs_atmos_0p25s.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fgefs.{{.Date}}%2F{{.Cycle}}%2Fatmos%2Fpgrb2sp25",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.pgrb2s.0p25.f{{pad 3 .FHour}}",
+		mirrorurl:         "https://noaa-gefs-pds.s3.amazonaws.com/gefs.{{.Date}}/{{.Cycle}}/atmos/pgrb2sp25/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gens/prod/gefs.{{.Date}}/{{.Cycle}}/atmos/pgrb2sp25/{{.File}}",
 	},
 	"gfs-ensemble-5": {
 		fn:                "geavg",  // filename for GRIB
@@ -642,28 +796,35 @@ var models = map[string]Model{
 		horizon:           "384h", // When is last forecast?
 		start:             "3.75h", // How long after run first forecast usually appears
 		end:               "6.5h",   // How long after run last forecast usually appears
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gefs_atmos_0p50a.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fgefs.%04d%02d%02d%%2F%02d%%2Fatmos%%2Fpgrb2ap5",
-		baseurlfn:         "%s.t%02dz.pgrb2a.0p50.f%03d",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_gefs_atmos_0p50a.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fgefs.{{.Date}}%2F{{.Cycle}}%2Fatmos%2Fpgrb2ap5",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.pgrb2a.0p50.f{{pad 3 .FHour}}",
+		mirrorurl:         "https://noaa-gefs-pds.s3.amazonaws.com/gefs.{{.Date}}/{{.Cycle}}/atmos/pgrb2ap5/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gens/prod/gefs.{{.Date}}/{{.Cycle}}/atmos/pgrb2ap5/{{.File}}",
 	},
 	"hrrr": {
 		fn:                "hrrr",
 		modelFrequency:    "1h",  // hrrr runs every hour
 		forecastFrequency: "1h",  // forecasts are one hour apart
-		horizon:           "18h", // hrrr is 18 hour forecast; for the 4 times a day it's longer use hrrr36
+		horizon:           "18h", // hrrr is 18 hour forecast; 48 for the synoptic runs, or use hrrr36 for only those
+		horizons:          map[int]string{0: "48h", 6: "48h", 12: "48h", 18: "48h"}, // The synoptic runs go to 48 hours
 		start:             "50m", // hrrr f00 50 minutes after the hour
 		end:               "85m", // f18 a bit more than 1/2 hour later
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_hrrr_2d.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fhrrr.%04d%02d%02d%%2Fconus",
-		baseurlfn:         "%s.t%02dz.wrfsfcf%02d.grib2",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_hrrr_2d.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fhrrr.{{.Date}}%2Fconus",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.wrfsfcf{{pad 2 .FHour}}.grib2",
+		mirrorurl:         "https://noaa-hrrr-bdp-pds.s3.amazonaws.com/hrrr.{{.Date}}/conus/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/hrrr/prod/hrrr.{{.Date}}/conus/{{.File}}",
 	},
-	"hrrr36": {
+	"hrrr36": { // Only the synoptic hrrr runs - named from when they went to 36 hours
 		fn:                "hrrr",
-		modelFrequency:    "6h",   // hrrr runs every hour, but every six hours the forecast is extended to 36 hours
+		modelFrequency:    "6h",   // hrrr runs every hour, but every six hours the forecast is extended to 48 hours
 		forecastFrequency: "1h",   // forecasts are one hour apart
-		horizon:           "36h",  // how many hours of forecast to fetch
+		horizon:           "48h",  // how many hours of forecast to fetch
 		start:             "50m",  // hrrr f00 50 minutes after the hour
-		end:               "110m", // f36 usually an hour after f00
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_hrrr_2d.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fhrrr.%04d%02d%02d%%2Fconus",
-		baseurlfn:         "%s.t%02dz.wrfsfcf%02d.grib2",
+		end:               "130m", // f48 usually 80 minutes after f00
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_hrrr_2d.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fhrrr.{{.Date}}%2Fconus",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.wrfsfcf{{pad 2 .FHour}}.grib2",
+		mirrorurl:         "https://noaa-hrrr-bdp-pds.s3.amazonaws.com/hrrr.{{.Date}}/conus/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/hrrr/prod/hrrr.{{.Date}}/conus/{{.File}}",
 	},
 	"hrrr_sub": { // Same as hrrr but has 15 minute sub-hourly forecasts
 		fn:                "hrrr",
@@ -672,18 +833,23 @@ var models = map[string]Model{
 		horizon:           "18h",
 		start:             "55m", // hrrr_sub f00 55 minutes after the hour
 		end:               "85m", // f18 usually 25 - 30 minutes later
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_hrrr_sub.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fhrrr.%04d%02d%02d%%2Fconus",
-		baseurlfn:         "%s.t%02dz.wrfsubhf%02d.grib2",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_hrrr_sub.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fhrrr.{{.Date}}%2Fconus",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.wrfsubhf{{pad 2 .FHour}}.grib2",
+		mirrorurl:         "https://noaa-hrrr-bdp-pds.s3.amazonaws.com/hrrr.{{.Date}}/conus/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/hrrr/prod/hrrr.{{.Date}}/conus/{{.File}}",
 	},
 	"nam": {
 		fn:                "nam",
 		modelFrequency:    "6h",   // hours between model runs - assume all run at 00z
 		forecastFrequency: "1h",   // hours between forecast steps
-		horizon:           "60h",  // NAM goes out 60 hours
+		horizon:           "84h",  // The parent NAM goes out 84 hours (the nests 60)
 		start:             "1.5h", // NAM forecasts show up about 1 1/2 hours after model run
-		end:               "3h",   // NAM 60 hour forecast completes about three hours after model run
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_nam.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fnam.%04d%02d%02d",
-		baseurlfn:         "%s.t%02dz.awphys%02d.tm00.grib2",
+		end:               "3.25h", // NAM 84 hour forecast completes a little over three hours after model run
+		steps:             []Step{{"0h", "36h", "1h"}, {"39h", "84h", "3h"}}, // Hourly to 36 hours then every 3
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_nam.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fnam.{{.Date}}",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.awphys{{pad 2 .FHour}}.tm00.grib2",
+		mirrorurl:         "https://noaa-nam-pds.s3.amazonaws.com/nam.{{.Date}}/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/nam/prod/nam.{{.Date}}/{{.File}}",
 	},
 	"nam-nest": {
 		fn:                "nam",
@@ -692,8 +858,10 @@ var models = map[string]Model{
 		horizon:           "60h",
 		start:             "1.5h",
 		end:               "3h",
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_nam_conusnest.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fnam.%04d%02d%02d",
-		baseurlfn:         "%s.t%02dz.conusnest.hiresf%02d.tm00.grib2",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_nam_conusnest.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fnam.{{.Date}}",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.conusnest.hiresf{{pad 2 .FHour}}.tm00.grib2",
+		mirrorurl:         "https://noaa-nam-pds.s3.amazonaws.com/nam.{{.Date}}/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/nam/prod/nam.{{.Date}}/{{.File}}",
 	},
 	"hi-nam-nest": {
 		fn:                "nam",
@@ -703,8 +871,97 @@ var models = map[string]Model{
 		start:             "1.5h",
 		end:               "3h",
 //                                    https://nomads.ncep.noaa.gov/cgi-bin/filter_nam_hawaiinest.pl?dir=%2Fnam.20250118&file=nam.t00z.hawaiinest.hiresf00.tm00.grib2&all_var=on&all_lev=on
-		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_nam_hawaiinest.pl?file=%s%s%s&subregion=&leftlon=%5.2f&rightlon=%5.2f&toplat=%5.2f&bottomlat=%5.2f&dir=%%2Fnam.%04d%02d%02d",
-		baseurlfn:         "%s.t%02dz.hawaiinest.hiresf%02d.tm00.grib2",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_nam_hawaiinest.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fnam.{{.Date}}",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.hawaiinest.hiresf{{pad 2 .FHour}}.tm00.grib2",
+		mirrorurl:         "https://noaa-nam-pds.s3.amazonaws.com/nam.{{.Date}}/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/nam/prod/nam.{{.Date}}/{{.File}}",
+	},
+	"rap": {
+		fn:                "rap",
+		modelFrequency:    "1h",  // RAP runs every hour
+		forecastFrequency: "1h",
+		horizon:           "21h",
+		start:             "50m", // rap f00 about 50 minutes after the hour
+		end:               "75m", // f21 25 minutes later
+		horizons:          map[int]string{3: "51h", 9: "51h", 15: "51h", 21: "51h"}, // Extended runs
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_rap.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Frap.{{.Date}}",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.awp130pgrbf{{pad 2 .FHour}}.grib2", // 13km CONUS
+		mirrorurl:         "https://noaa-rap-pds.s3.amazonaws.com/rap.{{.Date}}/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/rap/prod/rap.{{.Date}}/{{.File}}",
+	},
+	"rap32": { // Same as rap on the 32km North America grid - reaches well offshore
+		fn:                "rap",
+		modelFrequency:    "1h",
+		forecastFrequency: "1h",
+		horizon:           "21h",
+		start:             "50m",
+		end:               "75m",
+		horizons:          map[int]string{3: "51h", 9: "51h", 15: "51h", 21: "51h"},
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_rap32.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Frap.{{.Date}}",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.awip32f{{pad 2 .FHour}}.grib2",
+		mirrorurl:         "https://noaa-rap-pds.s3.amazonaws.com/rap.{{.Date}}/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/rap/prod/rap.{{.Date}}/{{.File}}",
+	},
+	"nbm": { // National Blend of Models, CONUS core
+		fn:                "blend",
+		modelFrequency:    "1h",  // Every hour
+		forecastFrequency: "1h",
+		horizon:           "36h",
+		start:             "1h",  // f001 about an hour after the cycle (there's no f000)
+		end:               "80m",
+		steps:             []Step{{"1h", "36h", "1h"}, {"39h", "192h", "3h"}, {"198h", "264h", "6h"}}, // Hourly, then 3 hourly to 8 days, 6 hourly to 11
+		horizons:          map[int]string{1: "264h", 7: "264h", 13: "264h", 19: "264h"},
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_blend.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fblend.{{.Date}}%2F{{.Cycle}}%2Fcore",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.core.f{{pad 3 .FHour}}.co.grib2",
+		mirrorurl:         "https://noaa-nbm-grib2-pds.s3.amazonaws.com/blend.{{.Date}}/{{.Cycle}}/core/{{.File}}",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/blend/prod/blend.{{.Date}}/{{.Cycle}}/core/{{.File}}",
+	},
+	"rtofs": { // Global RTOFS ocean model surface currents & temperature, the west CONUS/NE Pacific region
+		fn:                "rtofs_glo",
+		modelFrequency:    "24h", // Runs once a day at 00z
+		forecastFrequency: "6h",
+		horizon:           "192h", // 8 days
+		start:             "6h",   // The nowcast shows up about 6 hours after the cycle
+		end:               "9h",
+		// Hour 0 is the nowcast ending at the cycle (n024), then forecasts f006...
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_rtofs_west_conus.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Frtofs.{{.Date}}",
+		baseurlfn:         "{{.Model}}.t{{.Cycle}}z.{{if eq .FHour 0}}n024{{else}}f{{pad 3 .FHour}}{{end}}_west_conus_std.grb2",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/rtofs/prod/rtofs.{{.Date}}/{{.File}}",
+	},
+	"glwu": { // Great Lakes Wave Unstructured on the 2.5km Great Lakes grid
+		fn:                "glwu",
+		modelFrequency:    "1h", // Runs every hour
+		forecastFrequency: "1h",
+		horizon:           "0h", // The whole run is one file, so there's only "hour 0"
+		start:             "1h",
+		end:               "90m",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_glwu.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fglwu.{{.Date}}",
+		baseurlfn:         "{{.Model}}.grlc_2p5km.t{{.Cycle}}z.grib2",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/glwu/prod/glwu.{{.Date}}/{{.File}}",
+	},
+	"hafs-parent": { // HAFS-A hurricane model, the parent grid around the storm
+		fn:                "hfsa",
+		modelFrequency:    "6h",
+		forecastFrequency: "3h",
+		horizon:           "126h",
+		start:             "4h",
+		end:               "7h",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_hfsa.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fhfsa.{{.Date}}%2F{{.Cycle}}%2F{{.Storm}}",
+		baseurlfn:         "{{.Storm}}.{{.Date}}{{.Cycle}}.{{.Model}}.parent.atm.f{{pad 3 .FHour}}.grib2",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/hafs/prod/hfsa.{{.Date}}/{{.Cycle}}/{{.Storm}}/{{.File}}",
+		stormurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gfs/prod/gfs.{{.Date}}/{{.Cycle}}/atmos/gfs.t{{.Cycle}}z.syndata.tcvitals.tm00",
+	},
+	"hafs-storm": { // HAFS-A storm-following 2km nest
+		fn:                "hfsa",
+		modelFrequency:    "6h",
+		forecastFrequency: "3h",
+		horizon:           "126h",
+		start:             "4h",
+		end:               "7h",
+		baseurl:           "https://nomads.ncep.noaa.gov/cgi-bin/filter_hfsa.pl?file={{.File}}{{.Levels}}{{.Vars}}&subregion=&leftlon={{.West}}&rightlon={{.East}}&toplat={{.North}}&bottomlat={{.South}}&dir=%2Fhfsa.{{.Date}}%2F{{.Cycle}}%2F{{.Storm}}",
+		baseurlfn:         "{{.Storm}}.{{.Date}}{{.Cycle}}.{{.Model}}.storm.atm.f{{pad 3 .FHour}}.grib2",
+		probeurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/hafs/prod/hfsa.{{.Date}}/{{.Cycle}}/{{.Storm}}/{{.File}}",
+		stormurl:          "https://nomads.ncep.noaa.gov/pub/data/nccf/com/gfs/prod/gfs.{{.Date}}/{{.Cycle}}/atmos/gfs.t{{.Cycle}}z.syndata.tcvitals.tm00",
 	},
 }
 
@@ -749,36 +1006,6 @@ func prettyInt(i int64) string {
 
 }
 
-func fetchUrlWithCurl(url, fn string) (exitCode int) {
-	if verbose {
-		log.Printf("%s %s %s %s\n", "curl", "-o", fn, url)
-	}
-	cmd := exec.Command("curl", "--silent", "-o", fn, url)
-	//	cmd := exec.Command("curl", "--silent", "--compress", "-o", fn, url)
-	//	cmd := exec.Command("curl", "--silent", "-o", fn, url)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		// try to get the exit code
-		if exitError, ok := err.(*exec.ExitError); ok {
-			ws := exitError.Sys().(syscall.WaitStatus)
-			exitCode = ws.ExitStatus()
-		} else {
-			// This will happen (in OSX) if `name` is not available in $PATH,
-			// in this situation, exit code could not be get, and stderr will be
-			// empty string very likely, so we use the default fail code, and format err
-			// to string and set to stderr
-			log.Printf("Could not get exit code for failed program: %v", "curl")
-			exitCode = 1
-		}
-	} else {
-		// success, exitCode should be 0
-		ws := cmd.ProcessState.Sys().(syscall.WaitStatus)
-		exitCode = ws.ExitStatus()
-	}
-	return (exitCode)
-}
-
 var mu sync.Mutex
 var nextForecast = 0
 var wg sync.WaitGroup
@@ -790,6 +1017,7 @@ type result struct {
 }
 
 var forecasts []int
+var forecastMembers []string // Ensemble member of each forecast, "" for none
 var results []result
 var inProgress bool
 
@@ -801,13 +1029,7 @@ func storeResult(i int, f int, r string, fn string) {
 	mu.Unlock()
 }
 
-func fetchForecasts(id int, levels string, vars string, runDir string) {
-	knownCurlErrors := map[int]string{
-		7:  "connection timed out",
-		18: "connection closed with data remaining",
-		56: "connection reset",
-	}
-
+func fetchForecasts(ctx context.Context, id int, levels string, vars string, runDir string) {
 	for true {
 		// Get next forecast to fetch
 		mu.Lock()
@@ -822,23 +1044,35 @@ func fetchForecasts(id int, levels string, vars string, runDir string) {
 			return
 		}
 		forecast := forecasts[thisIndex]
+		member := forecastMembers[thisIndex]
 
-		urlfn := fmt.Sprintf(M.baseurlfn, M.fn, zulu.Hour(), forecast)
+		data, err := newUrlData(zulu, forecast, member, levels, vars)
+		url := ""
+		if err == nil {
+			url, err = expandUrl(M.baseurl, data)
+		}
+		if err != nil {
+			log.Printf("#%2d Hour %d URL: %v\n", thisIndex, forecast, err)
+			storeResult(thisIndex, forecast, "bad", "")
+			continue
+		}
+		urlfn := data.File
 		if verbose {
 			log.Printf("Fetching #%d: %d %s\n", thisIndex, forecast, urlfn)
 		}
 
-		// GFS has one directory per day, others one directory per model run
-		var url string
-		if (Z.model == "gfs") || (Z.model == "gfs_hourly") || (Z.model == "gfs-ensemble-5") || (Z.model == "gfs-ensemble-25") || (Z.model == "gfs-wave-global") || (Z.model == "gfs-wave-epacif") {
-			url = fmt.Sprintf(M.baseurl, urlfn, levels, vars, Z.longitude.west, Z.longitude.east, Z.latitude.north, Z.latitude.south, zulu.Year(), int(zulu.Month()), zulu.Day(), zulu.Hour())
-		} else {
-			url = fmt.Sprintf(M.baseurl, urlfn, levels, vars, Z.longitude.west, Z.longitude.east, Z.latitude.north, Z.latitude.south, zulu.Year(), int(zulu.Month()), zulu.Day())
-		}
-
 		fn := runDir + "/" + urlfn
+		get := func() (fetchResponse, error) { return fetchUrl(ctx, url, fn) }
+		if modelSource() == "mirror" {
+			if url, err = expandUrl(M.mirrorurl, data); err != nil {
+				log.Printf("#%2d Hour %d mirror URL: %v\n", thisIndex, forecast, err)
+				storeResult(thisIndex, forecast, "bad", "")
+				continue
+			}
+			get = func() (fetchResponse, error) { return fetchFromMirror(ctx, url, fn) }
+		}
 
-		_, err := os.Stat(fn)
+		_, err = os.Stat(fn)
 		if err == nil {
 			log.Printf("Skip (exists) %s\n", urlfn)
 			storeResult(thisIndex, forecast, "exists", fn)
@@ -846,76 +1080,265 @@ func fetchForecasts(id int, levels string, vars string, runDir string) {
 		}
 
 		log.Printf("Thread %d Fetching %s\n", id, urlfn)
-		ok := true
+		var resp fetchResponse
 		attempts := 0
-		errCode := 1
-		for (errCode != 0) && (attempts <= 5) && (ok) {
+		for true {
 			attempts += 1
 			if attempts > 1 {
-				log.Printf("Curl attempt #%d %v\n", attempts, urlfn)
+				log.Printf("HTTP attempt #%d %v\n", attempts, urlfn)
 			}
-			if errCode = fetchUrlWithCurl(url, fn); errCode != 0 {
-				if verbose {
-					log.Printf("fetchUrl returns %v\n", errCode)
-				}
-				fault, ok := knownCurlErrors[errCode]
-				if ok {
-					log.Printf("curl: failure %d: %s\n", errCode, fault)
-				} else {
-					log.Printf("curl: failure %d: %s\n", errCode, "Unexpected fault")
-				}
+			resp, err = get()
+			if err == nil || attempts > 5 || !resp.retryable(err) {
+				break
+			}
+			log.Printf("#%2d Hour %d %v - retrying\n", thisIndex, forecast, err)
+			wait := resp.retryAfter()
+			if wait <= 0 {
+				wait = time.Duration(1<<attempts) * time.Second
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
 			}
 		}
-		if !ok {
+		if err != nil {
+			if resp.status == http.StatusNotFound {
+				log.Printf("#%2d Hour %d not posted yet (404): %s\n", thisIndex, forecast, urlfn)
+			} else {
+				log.Printf("#%2d Hour %d fetch failed: %v\n", thisIndex, forecast, err)
+			}
+			if verbose {
+				log.Printf("URL: %s\n", url)
+				if resp.body != "" {
+					log.Printf("\n%s\n", resp.body)
+				}
+			}
 			_ = os.Remove(fn)
 			storeResult(thisIndex, forecast, "bad", "")
+			if inProgress && resp.status == http.StatusNotFound {
+				mu.Lock()
+				// Later forecasts won't be there either
+				nextForecast = len(forecasts)
+				mu.Unlock()
+			}
 			continue
 		}
 
-		// check to see if it's a GRIB
-		f, err := os.Open(fn)
+		// Check that it's a complete GRIB
+		msgs, err := readGrib2File(fn)
+		if err == nil && modelSource() != "nomads" {
+			// Only the filter scripts crop to the zone
+			if err = cropFile(fn, Z.longitude, Z.latitude); err == nil {
+				msgs, err = readGrib2File(fn)
+			}
+		}
 		if err == nil {
-			bytes := make([]byte, 4)
-			count, err := f.Read(bytes)
-			f.Close()
-			if (err == nil) && (count == 4) {
-				if string(bytes) == "GRIB" {
-					storeResult(thisIndex, forecast, "ok", fn)
-				} else {
-					log.Printf("#%2d Hour %d Not a GRIB: %s\n", thisIndex, forecast, fn)
-					if verbose {
-						log.Printf("URL: %s\n", url)
-						// print the contents of the file - should be error msg
-						f, _ = os.Open(fn) // it opened above, should open now
-						bytes = make([]byte, 10240)
-						f.Read(bytes)
-						f.Close()
-						log.Printf("\n%s\n", string(bytes))
-					}
-					_ = os.Remove(fn)
-					storeResult(thisIndex, forecast, "bad", "")
-					if inProgress {
-						mu.Lock()
-						// Stop other threads from starting another fetch
-						nextForecast = len(forecasts)
-						mu.Unlock()
-					}
-				}
-			} else {
-				log.Printf("Couldn't read GRIB 4-byte data header: %s\n", fn)
-				_ = os.Remove(fn)
-				storeResult(thisIndex, forecast, "bad", "")
+			if verbose {
+				log.Printf("#%2d Hour %d %d GRIB messages\n", thisIndex, forecast, len(msgs))
+			}
+			storeResult(thisIndex, forecast, "ok", fn)
+			recordAvailable(forecast)
+		} else if err == errNotGrib {
+			log.Printf("#%2d Hour %d Not a GRIB: %s\n", thisIndex, forecast, fn)
+			if verbose {
+				log.Printf("URL: %s\n", url)
+				// print the contents of the file - should be error msg
+				f, _ := os.Open(fn)
+				bytes := make([]byte, 10240)
+				f.Read(bytes)
+				f.Close()
+				log.Printf("\n%s\n", string(bytes))
+			}
+			_ = os.Remove(fn)
+			storeResult(thisIndex, forecast, "bad", "")
+			if inProgress {
+				mu.Lock()
+				// Stop other threads from starting another fetch
+				nextForecast = len(forecasts)
+				mu.Unlock()
 			}
 		} else {
-			log.Printf("Couldn't open: %s\n", fn)
+			log.Printf("#%2d Hour %d Bad GRIB %s: %v\n", thisIndex, forecast, fn, err)
 			_ = os.Remove(fn)
 			storeResult(thisIndex, forecast, "bad", "")
 		}
+	}
+}
+
+// Fetch the latest run of the zone's model. Returns errRunExists or
+// errRunDirExists if there's nothing to do without -merge or -refetch.
+func fetch(ctx context.Context) error {
+	startMonotonic := time.Now()
+	start := startMonotonic.Round(0)
+	utc := start.UTC()
 
+	modelFrequency, _ := time.ParseDuration(M.modelFrequency)
+	var forecastLast time.Time
+	var err error
+	if runFlag != "" {
+		zulu, forecastLast, inProgress, err = namedRun(ctx, utc, runFlag)
+		if err != nil {
+			return err
+		}
+	} else {
+		zulu, forecastLast, inProgress = chooseRun(ctx, utc, prev, partial)
 	}
+	if err = selectStorm(ctx); err != nil {
+		return err
+	}
+
+	run := runName(zulu)
+	log.Printf("Run: %s\n", run)
+	if inProgress {
+		local := forecastLast.Local()
+		log.Printf("%s %02dz run in progress - last should be complete at %02d:%02d\n", Z.model, zulu.Hour(), local.Hour(), local.Minute())
+	} else if utc.Before(zulu.Add(modelFrequency).Add(forecastLast.Sub(zulu))) {
+		// The run after this one is in progress
+		local := zulu.Add(modelFrequency).Add(forecastLast.Sub(zulu)).Local()
+		log.Printf("%s %02dz run in progress - last should be complete at %02d:%02d\n", Z.model, zulu.Add(modelFrequency).Hour(), local.Hour(), local.Minute())
+	}
+
+	summary, err := fetchRun(ctx, forecastLast)
+	if err != nil {
+		return err
+	}
+
+	if summary.good == 0 && summary.bad == 0 && summary.skipped == 0 {
+		// No gribs fetched - tell user when next model run happens
+		startLag, _ := modelLags(zulu.Add(modelFrequency))
+		nextStart := zulu.Add(modelFrequency).Add(startLag).Local()
+		nextEnd := forecastLast.Add(modelFrequency).Local()
+		log.Printf("No GRIBs fetched. Next model run starts at %02d:%02d and ends at %02d:%02d\n", nextStart.Hour(), nextStart.Minute(), nextEnd.Hour(), nextEnd.Minute())
+	}
+
+	finish := time.Now()
+	elapsed := time.Since(start)
+	log.Printf("Fetch finished @ %02d:%02d, elapsed %d:%02d:%02d\n", finish.Hour(), finish.Minute(), int64(elapsed.Hours()), int64(elapsed.Minutes())%60, int64(elapsed.Seconds())%60)
+	return nil
 }
 
-func fetch() {
+// Where composites go - Expedition's folder if it's installed
+func grb2Directory() string {
+	expeditionDir := "C:\\ProgramData\\Expedition\\grib"
+	if _, err := os.Stat(expeditionDir); err == nil {
+		return expeditionDir
+	}
+	usr, _ := user.Current()
+	return usr.HomeDir + "/Downloads/gribs/grb2"
+}
+
+// Forecast directory and composite name for the zone's run at zulu
+func runName(zulu time.Time) string {
+	return fmt.Sprintf("%04d-%02d-%02d_%02dz_%s_%s", zulu.Year(), int(zulu.Month()), zulu.Day(), zulu.Hour(), Z.geo, Z.model)
+}
+
+// The newest complete (or started, if partial) run, prev runs back - from
+// the server if it can be probed, otherwise from the lags
+func chooseRun(ctx context.Context, utc time.Time, prev int, partial bool) (run, forecastLast time.Time, inProgress bool) {
+	var err error = errNoProbe
+	if probe {
+		run, forecastLast, inProgress, err = probeRun(ctx, utc, prev, partial)
+		if err != nil && err != errNoProbe {
+			log.Printf("Probe failed, using model lags: %v\n", err)
+		}
+	}
+	if err != nil {
+		run, forecastLast, inProgress = latestRun(utc, prev, partial)
+	}
+	return run, forecastLast, inProgress
+}
+
+// The most recent run that should be complete (or started, if partial) at
+// utc based on the model's lags, prev runs back
+func latestRun(utc time.Time, prev int, partial bool) (run, forecastLast time.Time, inProgress bool) {
+	modelFrequency, _ := time.ParseDuration(M.modelFrequency)
+	run = utc.Truncate(modelFrequency) // Model run Zulu time
+	for i := 0; i < 48; i++ { // Lags can differ by cycle
+		if startLag, _ := modelLags(run); !utc.Before(run.Add(startLag)) {
+			break
+		}
+		run = run.Add(-modelFrequency)
+	}
+	run = run.Add(-modelFrequency * time.Duration(prev)) // weird construct casting prev (an int) to a duration
+	_, endLag := modelLags(run)
+	forecastLast = run.Add(endLag)
+	inProgress = utc.Before(forecastLast)
+
+	if inProgress && !partial {
+		// If the current run is in progress go back to the last complete run.
+		// If prev is true inProgress will always be false
+		run = run.Add(-modelFrequency)
+		_, endLag = modelLags(run)
+		forecastLast = run.Add(endLag)
+		inProgress = false
+	}
+	return run, forecastLast, inProgress
+}
+
+var errRunExists = errors.New("complete model run exists")
+var errRunDirExists = errors.New("forecast directory exists")
+
+// How a fetch of a model run went
+type fetchSummary struct {
+	grb2    string // The composite
+	good    int    // Forecasts fetched this time
+	skipped int    // Forecasts already on disk
+	bad     int    // Forecasts that couldn't be fetched or were bad
+}
+
+// The horizon of the model's run - some cycles go further than others
+func runHorizon(run time.Time) time.Duration {
+	horizon, _ := time.ParseDuration(M.horizon)
+	if h, ok := M.horizons[run.Hour()]; ok {
+		horizon, _ = time.ParseDuration(h)
+	}
+	return horizon
+}
+
+// The forecast hours of a run of the model, up to -horizon
+func forecastHours(run time.Time) []int {
+	horizon := runHorizon(run)
+	if lastHorizon != "" {
+	        lh, _ := time.ParseDuration(lastHorizon)
+		if verbose {
+		       log.Printf("M.horizon: %s lastHorizon %s horizon %.0f lh %.0f\n", M.horizon, lastHorizon, horizon.Hours(), lh.Hours())
+		}
+		if lh < horizon {
+		        horizon = lh
+		}
+	}
+
+	steps := M.steps
+	if len(steps) == 0 {
+		steps = []Step{{"0h", M.horizon, M.forecastFrequency}}
+	}
+
+	// Make a slice with all of the forecasts for this model run
+	var forecasts []int
+	for i, st := range steps {
+		from, _ := time.ParseDuration(st.from)
+		to, _ := time.ParseDuration(st.to)
+		step, _ := time.ParseDuration(st.step)
+		if step <= 0 {
+			continue
+		}
+		if i == len(steps)-1 || to > horizon {
+			to = horizon // The last rule runs on for cycles with a longer horizon
+		}
+		for hours := from; hours <= to; hours += step {
+			forecast := int(hours.Hours())
+			if n := len(forecasts); n > 0 && forecast <= forecasts[n-1] {
+				continue // Overlapping rules
+			}
+			forecasts = append(forecasts, forecast)
+		}
+	}
+	return forecasts
+}
+
+// Fetch the forecasts of the run at zulu and build the composite
+func fetchRun(ctx context.Context, forecastLast time.Time) (fetchSummary, error) {
+	var summary fetchSummary
 	levels := ""
 	if len(Z.modelLevels) == 1 && Z.modelLevels[0] == "all" {
 	        levels = "&all_lev=on"
@@ -933,54 +1356,26 @@ func fetch() {
 	       }
 	}
 
-	startMonotonic := time.Now()
-	start := startMonotonic.Round(0)
-	utc := start.UTC()
-
-	if Z.geo == "sf96" {
-		M.horizon = "96h" // Adjust GFS (default 384) for shorter horizon - should change M.endLag, too
+	members, err := expandMembers(Z.members)
+	if err != nil {
+		return summary, err
 	}
 
 	startLag, _ := time.ParseDuration(M.start)
-	endLag, _ := time.ParseDuration(M.end)
 	modelFrequency, _ := time.ParseDuration(M.modelFrequency)
-	forecastFrequency, _ := time.ParseDuration(M.forecastFrequency)
-	first := utc.Add(-startLag)
-	first = first.Add(-modelFrequency * time.Duration(prev)) // weird construct casting prev (an int) to a duration
-	zulu = first.Truncate(modelFrequency) // Model run Zulu time
-	forecastLast := zulu.Add(endLag)
-	inProgress = utc.Before(forecastLast)
-	var inProgressZulu time.Time
-	inProgressZulu = zulu
+	run := runName(zulu)
 
-	if inProgress && !partial {
-		// If the current run is in progress go back to the last complete run.
-		// If prev is true inProgress will always be false
-		first = first.Add(-modelFrequency)
-		zulu = first.Truncate(modelFrequency) // Model run Zulu time
-	}
-
-	run := fmt.Sprintf("%04d-%02d-%02d_%02dz_%s_%s", zulu.Year(), int(zulu.Month()), zulu.Day(), zulu.Hour(), Z.geo, Z.model)
-	log.Printf("Run: %s\n", run)
-	if inProgress {
-		local := forecastLast.Local()
-		log.Printf("%s %02dz run in progress - last should be complete at %02d:%02d\n", Z.model, inProgressZulu.Hour(), local.Hour(), local.Minute())
-	}
-
-	baseDir := ""
-	grb2Dir := ""
-	expeditionDir := "C:\\ProgramData\\Expedition\\grib"
-	_, err := os.Stat(expeditionDir)
-	if err == nil {
-	  baseDir = expeditionDir
-	  grb2Dir = baseDir
-	} else {
-	  usr, _ := user.Current()
-	  baseDir = usr.HomeDir + "/Downloads/gribs"
-	  grb2Dir = baseDir + "/grb2"
-	}
+	grb2Dir := grb2Directory()
 	runDir := grb2Dir + "/" + run
 	grb2 := grb2Dir + "/" + run + ".grb2"
+	composites := []string{grb2}
+	if Z.perMember && len(members) > 0 {
+		composites = nil
+		for _, m := range members {
+			composites = append(composites, grb2Dir+"/"+run+"_"+m+".grb2")
+		}
+		grb2 = composites[0]
+	}
 
 	_, err = os.Stat(grb2)
 	noGrb2 := (err != nil)
@@ -997,13 +1392,7 @@ func fetch() {
 		nextFirst := zulu.Add(modelFrequency).Add(startLag).Local()
 		nextLast := forecastLast.Add(modelFrequency).Local()
 		log.Printf("The next model run first forecast should appear at %02d:%02d and be complete at %02d:%02d\n", nextFirst.Hour(), nextFirst.Minute(), nextLast.Hour(), nextLast.Minute())
-		forecastLast = zulu.Add(modelFrequency)
-		os.Exit(1)
-	}
-
-	if !noGrb2 {
-		// Remove if refetching or merging from a previous partial fetch
-		_ = os.Remove(grb2)
+		return summary, errRunExists
 	}
 
 	if noRunDir { // Forecast directory doesn't exist
@@ -1020,7 +1409,7 @@ func fetch() {
 			log.Printf("Directory exists: %s\n", runDir)
 			log.Printf("Use -merge to fetch missing forecasts\n")
 			log.Printf("Use -refetch to overwwrite existing forecasts\n")
-			os.Exit(-1)
+			return summary, errRunDirExists
 		}
 
 		if refetch { // Delete previous grb files and any other cruft
@@ -1030,56 +1419,58 @@ func fetch() {
 	}
 
 	// We have a start time and all directories are in place. Fetch the gribs.
-	//	forecast0 := zulu.Add(startLag)
-	hours := time.Duration(0)
-	horizon, _ := time.ParseDuration(M.horizon)
-	if lastHorizon != "" {
-	        lh, _ := time.ParseDuration(lastHorizon)
-		if verbose {
-		       log.Printf("M.horizon: %s lastHorizon %s horizon %.0f lh %.0f\n", M.horizon, lastHorizon, horizon.Hours(), lh.Hours())
-		}
-		if lh < horizon {
-		        horizon = lh
-		}
-	}
-
-	// Make a slice with all of the forecasts for this model run
-	for hours <= horizon {
-		forecast := int(hours.Hours())
-		if ((Z.model == "gfs") && (forecast > 240) && (forecast%12 != 0)) ||
-		   ((Z.model == "gfs-wave-wcoast") && (forecast > 120) && (forecast%3 != 0)) {
-			// Skip this forecast is not in the model run -
-			//    gfs goes every 12 hours after 10 days
-			//    gfs-wave goes every 3 hours after 5 days
-		} else {
-			forecasts = append(forecasts, forecast)
+	forecasts = forecastHours(zulu)
+	forecastMembers = make([]string, len(forecasts))
+	if len(members) > 0 {
+		// Every member of each hour, hour by hour
+		hours := forecasts
+		forecasts, forecastMembers = nil, nil
+		for _, h := range hours {
+			for _, m := range members {
+				forecasts = append(forecasts, h)
+				forecastMembers = append(forecastMembers, m)
+			}
 		}
-		hours += forecastFrequency
 	}
+	nextForecast = 0
 	results = make([]result, len(forecasts))
 
 	// Create goroutines to fetch N URLs concurrently
 	wg.Add(threads)
 	for i := 0; i < threads; i++ {
-		go fetchForecasts(i, levels, vars, runDir)
+		go fetchForecasts(ctx, i, levels, vars, runDir)
 	}
 	wg.Wait() // Wait for the goroutines to complete
 
+	// Make sure the forecasts have what was asked for
+	if gaps := verifyInventory(); gaps > 0 && !Z.requireAllFields {
+		log.Printf("%d forecasts are missing fields\n", gaps)
+	}
+
 	// At this point the forecasts are in the files named in the results[] slice
 	goodGribCount := 0
 	skipGribCount := 0
 	badGribCount := 0
 	var gribs []string
+	var gribMembers []string
+	var gribHours []int
 	badGribs := ""
 
 	for i, r := range results {
 		if results[i].result == "ok" {
 			goodGribCount++
 			gribs = append(gribs, r.filename)
+			gribMembers = append(gribMembers, forecastMembers[i])
+			gribHours = append(gribHours, r.forecast)
 		} else if r.result == "exists" {
 			skipGribCount++
 			gribs = append(gribs, r.filename)
+			gribMembers = append(gribMembers, forecastMembers[i])
+			gribHours = append(gribHours, r.forecast)
 		} else if r.result == "bad" {
+			if forecastMembers[i] != "" {
+				badGribs = fmt.Sprintf("%s %s", badGribs, forecastMembers[i])
+			}
 			badGribs = fmt.Sprintf("%s %d", badGribs, r.forecast)
 			badGribCount++
 		} else {
@@ -1100,40 +1491,60 @@ func fetch() {
 		}
 	}
 
-	if (goodGribCount == 0) && (badGribCount == 0) {
-		// No gribs fetched - tell user when next model run happens
-		nextStart := first.Add(modelFrequency).Local()
-		nextEnd := forecastLast.Add(modelFrequency).Local()
-		log.Printf("No GRIBs fetched. Next model run starts at %02d:%02d and ends at %02d:%02d\n", nextStart.Hour(), nextStart.Minute(), nextEnd.Hour(), nextEnd.Minute())
-	}
-
-	// Fetched at least one new GRIB. Make a composite by catting them together
-	if goodGribCount > 0 {
-		// Create the outputfile
-		out, err := os.Create(grb2)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for _, fc := range gribs {
-			f, err := os.Open(fc)
+	// Fetched at least one new GRIB, or there are forecasts from a partial
+	// fetch but no composite. Make a composite by catting them together.
+	// Otherwise leave the previous composite alone - a -merge (or a daemon
+	// poll) that finds nothing new mustn't take it away.
+	if goodGribCount > 0 || (noGrb2 && skipGribCount > 0) {
+		for c, composite := range composites {
+			// Create the outputfile
+			out, err := os.Create(composite)
 			if err != nil {
-				log.Printf("Open failed: %s\n", fc)
-				log.Fatal(err)
+				return summary, err
 			}
-			bytes, err := io.Copy(out, f)
-			if err != nil {
-				log.Printf("Copy failed: %s\n", fc)
-				log.Fatal(err)
+
+			for i, fc := range gribs {
+				if Z.perMember && gribMembers[i] != members[c] {
+					continue
+				}
+				// Files from earlier runs (-merge) haven't been checked yet
+				data, err := compositeData(fc)
+				if err == nil && gribMembers[i] != "" {
+					data, err = ensembleData(data, gribMembers[i])
+				}
+				if err != nil {
+					log.Printf("Skipping bad GRIB %s: %v\n", fc, err)
+					_ = os.Remove(fc)
+					badGribCount++
+					continue
+				}
+				bytes, err := out.Write(data)
+				if err != nil {
+					log.Printf("Write failed: %s\n", fc)
+					out.Close()
+					return summary, err
+				}
+				if verbose {
+					log.Printf("%s: %d bytes\n", fc, bytes)
+				}
 			}
-			if verbose {
-				log.Printf("%s: %d bytes\n", fc, bytes)
+			_ = out.Close()
+			st, _ := os.Stat(composite)
+			log.Printf("GRIB %s %s (%d bytes)\n", composite, prettyInt(st.Size()), st.Size())
+		}
+		if Z.ensembleStats && len(members) > 1 {
+			var memberGribs []string
+			var memberHours []int
+			for i, fc := range gribs {
+				if _, _, ok := memberInfo(gribMembers[i]); ok {
+					memberGribs = append(memberGribs, fc)
+					memberHours = append(memberHours, gribHours[i])
+				}
+			}
+			if err := ensembleStatistics(grb2Dir+"/"+run+"_stats.grb2", memberGribs, memberHours); err != nil {
+				log.Printf("Ensemble statistics: %v\n", err)
 			}
-			_ = f.Close()
 		}
-		_ = out.Close()
-		st, _ := os.Stat(grb2)
-		log.Printf("GRIB %s %s (%d bytes)\n", grb2, prettyInt(st.Size()), st.Size())
 		if !keep && (badGribCount == 0) {
 			// Delete the individual forecasts if this was a complete fetch
 			if verbose {
@@ -1143,9 +1554,11 @@ func fetch() {
 		}
 	}
 
-	finish := time.Now()
-	elapsed := time.Since(start)
-	log.Printf("Fetch finished @ %02d:%02d, elapsed %d:%02d:%02d\n", finish.Hour(), finish.Minute(), int64(elapsed.Hours()), int64(elapsed.Minutes())%60, int64(elapsed.Seconds())%60)
+	summary.grb2 = grb2
+	summary.good = goodGribCount
+	summary.skipped = skipGribCount
+	summary.bad = badGribCount
+	return summary, nil
 }
 
 func Usage() {
@@ -1174,12 +1587,32 @@ func args() {
 	flag.BoolVar(&refetch, "refetch", false, "Refetch all forecasts for this run")
 	flag.BoolVar(&keep, "keep", false, "Keep forecast directory after complete model fetch (default is to delete)")
 	flag.IntVar(&threads, "threads", 4, "# of concurrent HTTP connections")
+	flag.DurationVar(&fetchTimeout, "timeout", 5*time.Minute, "Time limit for each forecast download (0 for none)")
+	flag.BoolVar(&probe, "probe", true, "Find the newest posted run by checking the server rather than from the model's lags")
+	flag.StringVar(&runFlag, "run", "", "Model run to fetch: a cycle (2026-10-15T12Z), latest-complete or latest-started")
+	flag.StringVar(&stormFlag, "storm", "", "Storm ID (05L) or name for per-storm models (HAFS)")
+	flag.BoolVar(&listStorms, "storms", false, "List the active storms for the region's per-storm model")
 	flag.StringVar(&zone, "region", "", "Model & Area to fetch")
 	flag.StringVar(&lastHorizon, "horizon", "", "Last forecast to fetch in hours (format NNh)")
 	flag.BoolVar(&verbose, "verbose", false, "Verbose")
+	flag.StringVar(&source, "source", "", "Where to fetch: nomads (filter scripts) or mirror (byte ranges from cloud mirrors)")
+	flag.BoolVar(&earthWinds, "earth-winds", false, "Rotate grid-relative winds to earth-relative in the composite")
+	flag.BoolVar(&deriveWinds, "derive-winds", false, "Add wind speed and direction computed from U/V to the composite")
+	flag.BoolVar(&gustFactor, "gust-factor", false, "With -derive-winds, also add the gust factor (NCEP local parameter 0.2.250) computed from GUST")
+	flag.StringVar(&configFile, "config", "", "Zone & model config file (JSON or TOML) merged over the built-in definitions")
+	flag.BoolVar(&daemon, "daemon", false, "Keep running, fetching each new model run of the regions (comma separated) as it's posted")
+	flag.DurationVar(&pollInterval, "poll", 5*time.Minute, "How often -daemon checks for forecasts of a run in progress")
+	flag.StringVar(&historyFile, "history", "", "Forecast availability history file (default "+defaultHistoryFile()+")")
+	flag.StringVar(&thresholdList, "thresholds", "", "Wind & gust exceedance thresholds in knots for ensemble statistics (default 20,25,30)")
+	flag.BoolVar(&learnedLags, "learned-lags", false, "Time runs with the lags seen in the history instead of the model's start & end")
 	flag.BoolVar(&help, "help", false, "Print usage message")
 	flag.Parse()
 
+	if err := loadConfigs(); err != nil {
+		log.Printf("Config: %v\n", err)
+		os.Exit(-1)
+	}
+
 	if help {
 		Usage()
 	}
@@ -1189,12 +1622,46 @@ func args() {
 		Usage()
 	}
 
-	var ok bool
-	Z, ok = zones[zone]
-	if !ok {
-		fmt.Printf("Unknown region: %v\n", zone)
+	if !daemon && strings.Contains(zone, ",") {
+		fmt.Printf("Only -daemon takes more than one region\n")
 		Usage()
 	}
+	for _, id := range strings.Split(zone, ",") {
+		if _, ok := zones[id]; !ok {
+			fmt.Printf("Unknown region: %v\n", id)
+			Usage()
+		}
+	}
+
+	if source != "" && source != "nomads" && source != "mirror" {
+		fmt.Printf("Unknown source: %v\n", source)
+		Usage()
+	}
+
+	for _, id := range strings.Split(zone, ",") {
+		if len(zones[id].blend) > 0 && (daemon || runFlag != "") {
+			fmt.Printf("Blend region %s can't be used with -daemon or -run\n", id)
+			Usage()
+		}
+	}
+
+	if runFlag != "" {
+		if _, err := parseRun(runFlag); err != nil {
+			fmt.Printf("%v\n", err)
+			Usage()
+		}
+		if prev != 0 || partial || daemon {
+			fmt.Printf("-run can't be used with -prev, -partial or -daemon\n")
+			Usage()
+		}
+	}
+
+	if thresholdList != "" {
+		if _, err := parseThresholds(thresholdList); err != nil {
+			fmt.Printf("-thresholds: %v\n", err)
+			Usage()
+		}
+	}
 
 	if refetch && merge {
 		fmt.Printf("Specify only one of merge & refetch\n")
@@ -1206,14 +1673,82 @@ func args() {
 	}
 }
 
-func main() {
-	args()
-	log.Printf("Fetching region %v model %s west %5.2f east %5.2f north %5.2f south %5.2f\n", zone, Z.model, Z.longitude.west, Z.longitude.east, Z.latitude.north, Z.latitude.south)
+// Make id the current zone and its model the current model
+func useZone(id string) error {
 	var ok bool
+	zone = id
+	Z = zones[id]
 	M, ok = models[Z.model]
 	if !ok {
-		log.Printf("Zone %s has no associated model '%s'\n", zone, Z.model)
+		return fmt.Errorf("zone %s has no associated model '%s'", id, Z.model)
+	}
+	if Z.geo == "sf96" {
+		M.horizon = "96h" // Adjust GFS (default 384) for shorter horizon - should change M.endLag, too
+	}
+	if modelSource() == "mirror" && M.mirrorurl == "" {
+		return fmt.Errorf("model %s has no mirror", Z.model)
+	}
+	if err := checkUrlTemplates(M); err != nil {
+		return fmt.Errorf("model %s: %v", Z.model, err)
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "schedule" {
+		scheduleCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "point" {
+		pointCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "route" {
+		routeCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "router" {
+		routerCommand(os.Args[2:])
+		return
+	}
+	args()
+	// Interrupting cancels outstanding fetches so no partial files are left
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if daemon {
+		if err := runDaemon(ctx, strings.Split(zone, ",")); err != nil {
+			log.Printf("Daemon: %v\n", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if len(zones[zone].blend) > 0 {
+		if err := runBlend(ctx, zone); err != nil {
+			log.Printf("Blend: %v\n", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if err := useZone(zone); err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+	if listStorms {
+		printStorms(ctx)
+		return
+	}
+	log.Printf("Fetching region %v model %s west %5.2f east %5.2f north %5.2f south %5.2f\n", zone, Z.model, Z.longitude.west, Z.longitude.east, Z.latitude.north, Z.latitude.south)
+	switch err := fetch(ctx); err {
+	case nil:
+	case errRunExists:
+		os.Exit(1)
+	case errRunDirExists:
+		os.Exit(-1)
+	default:
+		log.Printf("Fetch: %v\n", err)
 		os.Exit(-1)
 	}
-	fetch()
 }
@@ -0,0 +1,50 @@
+package main
+
+import "reflect"
+import "testing"
+import "time"
+
+// from, from+step ... to
+func hourRange(from, to, step int) []int {
+	var hours []int
+	for h := from; h <= to; h += step {
+		hours = append(hours, h)
+	}
+	return hours
+}
+
+func TestForecastHours(t *testing.T) {
+	join := func(parts ...[]int) []int {
+		var hours []int
+		for _, p := range parts {
+			hours = append(hours, p...)
+		}
+		return hours
+	}
+	tests := []struct {
+		model   string
+		cycle   int
+		horizon string // -horizon
+		want    []int
+	}{
+		{"gfs", 0, "", hourRange(0, 384, 6)},
+		{"gfs", 6, "48h", hourRange(0, 48, 6)},
+		{"gfs_hourly", 12, "", join(hourRange(0, 120, 1), hourRange(123, 384, 3))},
+		{"gfs_hourly", 12, "130h", join(hourRange(0, 120, 1), hourRange(123, 129, 3))},
+		{"hrrr", 1, "", hourRange(0, 18, 1)},
+		{"hrrr", 18, "", hourRange(0, 48, 1)},
+		{"hrrr", 18, "24h", hourRange(0, 24, 1)},
+		{"nbm", 0, "", hourRange(1, 36, 1)},
+		{"nbm", 7, "", join(hourRange(1, 36, 1), hourRange(39, 192, 3), hourRange(198, 264, 6))},
+		{"nam", 6, "", join(hourRange(0, 36, 1), hourRange(39, 84, 3))},
+	}
+	saveM, saveHorizon := M, lastHorizon
+	defer func() { M, lastHorizon = saveM, saveHorizon }()
+	for _, tc := range tests {
+		M, lastHorizon = models[tc.model], tc.horizon
+		run := time.Date(2026, 7, 6, tc.cycle, 0, 0, 0, time.UTC)
+		if got := forecastHours(run); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s %02dz -horizon %q: %v\nwant %v", tc.model, tc.cycle, tc.horizon, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import "context"
+import "encoding/csv"
+import "encoding/json"
+import "flag"
+import "fmt"
+import "log"
+import "math"
+import "os"
+import "strconv"
+import "strings"
+import "time"
+
+// nomads point -region sf [-points "GG=37.82,-122.48;Alcatraz=37.83,-122.42"]
+//
+// Every variable at every step of the region's newest composite (or -file),
+// interpolated at named points - the zone's points unless -points is
+// given. Writes <run>_points.csv and .json next to the composite with UTC
+// and local times; winds and currents are in knots, temperatures in C and
+// pressures in hPa.
+
+type Point struct {
+	name     string
+	lat, lon float64
+}
+
+// name=lat,lon;name=lat,lon
+func parsePoints(list string) ([]Point, error) {
+	var points []Point
+	for _, p := range strings.Split(list, ";") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		name, ll, ok := strings.Cut(p, "=")
+		lat, lon, ok2 := strings.Cut(ll, ",")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("bad point '%s' (want name=lat,lon)", p)
+		}
+		la, err1 := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		lo, err2 := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+		if err1 != nil || err2 != nil || math.Abs(la) > 90 {
+			return nil, fmt.Errorf("bad point '%s'", p)
+		}
+		points = append(points, Point{strings.TrimSpace(name), la, lo})
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no points")
+	}
+	return points, nil
+}
+
+type pointStep struct {
+	UTC      time.Time           `json:"utc"`
+	Local    string              `json:"local"`
+	Forecast int                 `json:"forecast"` // Hours
+	Values   map[string]*float64 `json:"values"`   // nil if off the grid or missing
+}
+
+type pointSeries struct {
+	Name  string      `json:"name"`
+	Lat   float64     `json:"lat"`
+	Lon   float64     `json:"lon"`
+	Steps []pointStep `json:"steps"`
+}
+
+type pointFile struct {
+	File   string            `json:"file"`
+	Units  map[string]string `json:"units"`
+	Points []pointSeries     `json:"points"`
+}
+
+// Sample the series at the points, in display units
+func samplePoints(s *gribSeries, points []Point, loc *time.Location) pointFile {
+	pf := pointFile{File: s.fn, Units: map[string]string{}}
+	for _, key := range s.keys {
+		pf.Units[key], _ = displayUnits(key)
+	}
+	for _, p := range points {
+		ps := pointSeries{Name: p.name, Lat: p.lat, Lon: p.lon}
+		for _, t := range s.times {
+			step := pointStep{
+				UTC:      t,
+				Local:    t.In(loc).Format(time.RFC3339),
+				Forecast: int(t.Sub(s.refTime(t)).Hours()),
+				Values:   map[string]*float64{},
+			}
+			for _, key := range s.keys {
+				v := s.stepValue(key, t, p.lat, p.lon)
+				if math.IsNaN(v) {
+					step.Values[key] = nil
+					continue
+				}
+				_, convert := displayUnits(key)
+				v = convert(v)
+				step.Values[key] = &v
+			}
+			ps.Steps = append(ps.Steps, step)
+		}
+		pf.Points = append(pf.Points, ps)
+	}
+	return pf
+}
+
+// One row per point and step, one column per variable
+func writePointsCSV(fn string, keys []string, pf pointFile) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	header := []string{"point", "lat", "lon", "utc", "local", "forecast"}
+	for _, key := range keys {
+		if u := pf.Units[key]; u != "" {
+			key += " (" + u + ")"
+		}
+		header = append(header, key)
+	}
+	w.Write(header)
+	for _, p := range pf.Points {
+		for _, st := range p.Steps {
+			row := []string{p.Name, strconv.FormatFloat(p.Lat, 'f', -1, 64), strconv.FormatFloat(p.Lon, 'f', -1, 64),
+				st.UTC.Format(time.RFC3339), st.Local, strconv.Itoa(st.Forecast)}
+			for _, key := range keys {
+				v := ""
+				if st.Values[key] != nil {
+					v = strconv.FormatFloat(*st.Values[key], 'f', 2, 64)
+				}
+				row = append(row, v)
+			}
+			w.Write(row)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func pointCommand(arguments []string) {
+	fs := flag.NewFlagSet("point", flag.ExitOnError)
+	region := fs.String("region", "", "Region whose newest composite to read")
+	file := fs.String("file", "", "Composite to read instead of the region's newest")
+	list := fs.String("points", "", "Points as name=lat,lon;name=lat,lon (default the region's points)")
+	tz := fs.String("tz", "Local", "Time zone for local times, e.g. America/Los_Angeles")
+	fs.StringVar(&stormFlag, "storm", "", "Storm ID (05L) or name for per-storm zones (HAFS)")
+	fs.StringVar(&configFile, "config", "", "Zone & model config file (JSON or TOML) merged over the built-in definitions")
+	fs.Parse(arguments)
+
+	if err := loadConfigs(); err != nil {
+		log.Printf("Config: %v\n", err)
+		os.Exit(-1)
+	}
+	points, err := pointsFor(*region, *list)
+	if err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+	fn := *file
+	if _, ok := zones[*region]; fn == "" && !ok {
+		log.Printf("Unknown region '%s'\n", *region)
+		os.Exit(-1)
+	}
+	if fn == "" {
+		if fn, err = latestComposite(context.Background(), grb2Directory(), *region); err != nil {
+			log.Printf("%v\n", err)
+			os.Exit(-1)
+		}
+	}
+	s, err := loadSeries(fn)
+	if err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+
+	pf := samplePoints(s, points, loc)
+	base := strings.TrimSuffix(fn, ".grb2") + "_points"
+	if err := writePointsCSV(base+".csv", s.keys, pf); err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+	data, err := json.MarshalIndent(pf, "", "  ")
+	if err == nil {
+		err = os.WriteFile(base+".json", append(data, '\n'), 0644)
+	}
+	if err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+	log.Printf("%d points x %d steps x %d variables in %s.csv and .json\n", len(points), len(s.times), len(s.keys), base)
+}
+
+// The -points list, or the region's points
+func pointsFor(region, list string) ([]Point, error) {
+	if list != "" {
+		return parsePoints(list)
+	}
+	z, ok := zones[region]
+	if !ok {
+		return nil, fmt.Errorf("unknown region '%s'", region)
+	}
+	if len(z.points) == 0 {
+		return nil, fmt.Errorf("region %s has no points - use -points", region)
+	}
+	return z.points, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import "math"
+import "os"
+import "path/filepath"
+import "reflect"
+import "testing"
+import "time"
+
+func TestParsePoints(t *testing.T) {
+	got, err := parsePoints("GG=37.82,-122.48; Alcatraz = 37.83 , -122.42;")
+	want := []Point{{"GG", 37.82, -122.48}, {"Alcatraz", 37.83, -122.42}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v %v", got, err)
+	}
+	for _, bad := range []string{"", ";", "GG", "GG=37.82", "GG=north,-122.48", "GG=91,-122.48"} {
+		if _, err := parsePoints(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+// A temperature rising 1 K an hour and a 10 m/s southerly at 6 and 9 hours
+func TestSamplePoints(t *testing.T) {
+	g := testLatLonGrid(3, 3, 38, 237, 0.5)
+	field := func(v float64) []float64 {
+		vals := make([]float64, g.nx*g.ny)
+		for i := range vals {
+			vals[i] = v
+		}
+		return vals
+	}
+	var data []byte
+	for _, h := range []int{6, 9} {
+		data = append(data, testMessage(g, 0, 0, h, 2, field(283.15+float64(h)))...)
+		data = append(data, testMessage(g, 2, 2, h, 2, field(0))...)
+		data = append(data, testMessage(g, 2, 3, h, 2, field(10))...)
+	}
+	fn := filepath.Join(t.TempDir(), "test.grb2")
+	if err := os.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSeries(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.times) != 2 || len(s.keys) != 3 {
+		t.Fatalf("%d steps of %v", len(s.times), s.keys)
+	}
+
+	// Between the steps the series interpolates in time
+	run := time.Date(2026, 7, 6, 12, 0, 0, 0, time.UTC)
+	if v := s.value("TMP:10_m_above_ground", run.Add(7*time.Hour), 37.5, -122.5); math.Abs(v-290.15) > 0.01 {
+		t.Errorf("TMP at 7 hours %g, want 290.15", v)
+	}
+	if v := s.value("TMP:10_m_above_ground", run.Add(10*time.Hour), 37.5, -122.5); !math.IsNaN(v) {
+		t.Errorf("TMP after the run %g", v)
+	}
+
+	pf := samplePoints(s, []Point{{"in", 37.6, -122.6}, {"out", 40, -122.5}}, time.UTC)
+	if pf.Units["TMP:10_m_above_ground"] != "C" || pf.Units["VGRD:10_m_above_ground"] != "kt" {
+		t.Errorf("units %v", pf.Units)
+	}
+	in, out := pf.Points[0], pf.Points[1]
+	if len(in.Steps) != 2 || in.Steps[1].Forecast != 9 {
+		t.Fatalf("steps %+v", in.Steps)
+	}
+	if v := in.Steps[1].Values["TMP:10_m_above_ground"]; v == nil || math.Abs(*v-19) > 0.01 {
+		t.Errorf("TMP at 9 hours %v, want 19 C", v)
+	}
+	if v := in.Steps[0].Values["VGRD:10_m_above_ground"]; v == nil || math.Abs(*v-10/metresPerSecondPerKnot) > 0.01 {
+		t.Errorf("VGRD %v, want 19.4 kt", v)
+	}
+	if v := out.Steps[0].Values["TMP:10_m_above_ground"]; v != nil {
+		t.Errorf("off the grid %g", *v)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import "bufio"
+import "fmt"
+import "math"
+import "os"
+import "strconv"
+import "strings"
+
+// Boat polars in the usual tab-separated form - true wind speeds (knots)
+// across the top, true wind angles down the side, boat speeds in knots:
+//
+//   TWA\TWS	6	8	10	12
+//   52	5.1	6.0	6.6	6.9
+//   90	5.9	7.0	7.7	8.1
+//   150	4.2	5.4	6.5	7.4
+//
+// Speeds in between are interpolated, above the top wind speed held, and
+// below the first angle zero.
+
+type polar struct {
+	tws   []float64
+	twa   []float64
+	speed [][]float64 // [twa][tws]
+}
+
+func readPolar(fn string) (*polar, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p := &polar{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.FieldsFunc(scanner.Text(), func(r rune) bool { return r == '\t' || r == ';' || r == ' ' })
+		if len(fields) == 0 {
+			continue
+		}
+		var vals []float64
+		for _, s := range fields[1:] {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: bad number '%s'", fn, line, s)
+			}
+			vals = append(vals, v)
+		}
+		if p.tws == nil {
+			p.tws = vals
+			continue
+		}
+		twa, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad angle '%s'", fn, line, fields[0])
+		}
+		if len(vals) != len(p.tws) {
+			return nil, fmt.Errorf("%s:%d: %d speeds for %d wind speeds", fn, line, len(vals), len(p.tws))
+		}
+		if n := len(p.twa); n > 0 && twa <= p.twa[n-1] {
+			return nil, fmt.Errorf("%s:%d: angles must increase", fn, line)
+		}
+		p.twa = append(p.twa, twa)
+		p.speed = append(p.speed, vals)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(p.tws) == 0 || len(p.twa) == 0 {
+		return nil, fmt.Errorf("%s: empty polar", fn)
+	}
+	for i := 1; i < len(p.tws); i++ {
+		if p.tws[i] <= p.tws[i-1] {
+			return nil, fmt.Errorf("%s: wind speeds must increase", fn)
+		}
+	}
+	return p, nil
+}
+
+// Where x falls in increasing xs: the index below and the fraction of the
+// way to the next
+func bracket(xs []float64, x float64) (int, float64) {
+	if x <= xs[0] {
+		return 0, 0
+	}
+	for i := 1; i < len(xs); i++ {
+		if x <= xs[i] {
+			return i - 1, (x - xs[i-1]) / (xs[i] - xs[i-1])
+		}
+	}
+	return len(xs) - 1, 0
+}
+
+// Boat speed at a true wind angle (degrees, either tack) and speed (knots)
+func (p *polar) boatSpeed(twa, tws float64) float64 {
+	twa = math.Abs(math.Mod(twa, 360))
+	if twa > 180 {
+		twa = 360 - twa
+	}
+	if twa < p.twa[0] || tws <= 0 {
+		return 0
+	}
+	// Below the lightest wind speed, scale down to nothing
+	scale := 1.0
+	if tws < p.tws[0] {
+		scale, tws = tws/p.tws[0], p.tws[0]
+	}
+	i, fi := bracket(p.twa, twa)
+	j, fj := bracket(p.tws, tws)
+	at := func(i, j int) float64 {
+		return p.speed[min(i, len(p.twa)-1)][min(j, len(p.tws)-1)]
+	}
+	v := (1-fi)*(1-fj)*at(i, j) + fi*(1-fj)*at(i+1, j) + (1-fi)*fj*at(i, j+1) + fi*fj*at(i+1, j+1)
+	return v * scale
+}
+
+// Best velocity made good towards (up) and away from (down) the wind, and
+// the angles that give it
+func (p *polar) bestVMG(tws float64) (upAngle, up, downAngle, down float64) {
+	for a := p.twa[0]; a <= 180; a++ {
+		vmg := p.boatSpeed(a, tws) * math.Cos(radians(a))
+		if vmg > up {
+			upAngle, up = a, vmg
+		}
+		if -vmg > down {
+			downAngle, down = a, -vmg
+		}
+	}
+	return upAngle, up, downAngle, down
+}
+
+// Speed made good along a course at a true wind angle, tacking or gybing
+// when that's quicker than sailing it straight
+func (p *polar) courseSpeed(twa, tws float64) float64 {
+	twa = math.Abs(math.Mod(twa, 360))
+	if twa > 180 {
+		twa = 360 - twa
+	}
+	upAngle, up, downAngle, down := p.bestVMG(tws)
+	switch {
+	case twa < upAngle:
+		return up / math.Cos(radians(twa))
+	case twa > downAngle:
+		return down / -math.Cos(radians(twa))
+	}
+	return p.boatSpeed(twa, tws)
+}
@@ -0,0 +1,82 @@
+package main
+
+import "math"
+import "os"
+import "path/filepath"
+import "strings"
+import "testing"
+
+const testPolar = "TWA\\TWS\t6\t8\t10\t12\n52\t5.1\t6.0\t6.6\t6.9\n90\t5.9\t7.0\t7.7\t8.1\n150\t4.2\t5.4\t6.5\t7.4\n"
+
+func writeTestPolar(t *testing.T, text string) string {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "boat.pol")
+	if err := os.WriteFile(fn, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestReadPolar(t *testing.T) {
+	p, err := readPolar(writeTestPolar(t, testPolar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.tws) != 4 || len(p.twa) != 3 || p.speed[1][2] != 7.7 {
+		t.Errorf("%+v", p)
+	}
+
+	tests := []struct {
+		text, want string
+	}{
+		{"", "empty polar"},
+		{"TWA\t6\t8\n52\t5.1\tfast\n", ":2: bad number 'fast'"},
+		{"TWA\t6\t8\n52\t5.1\n", ":2: 1 speeds for 2 wind speeds"},
+		{"TWA\t6\t8\n90\t5.1\t6\n52\t5.9\t7\n", ":3: angles must increase"},
+		{"TWA\t8\t6\n52\t5.1\t6\n", "wind speeds must increase"},
+	}
+	for _, tc := range tests {
+		if _, err := readPolar(writeTestPolar(t, tc.text)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: %v, want %s", tc.text, err, tc.want)
+		}
+	}
+}
+
+func TestBoatSpeed(t *testing.T) {
+	p, err := readPolar(writeTestPolar(t, testPolar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		twa, tws, want float64
+	}{
+		{90, 10, 7.7},
+		{-90, 10, 7.7}, // Either tack
+		{270, 10, 7.7},
+		{90, 9, 7.35},  // Between wind speeds
+		{120, 10, 7.1}, // Between angles
+		{90, 20, 8.1},  // Above the top wind speed
+		{90, 3, 2.95},  // Half the lightest
+		{40, 10, 0},    // Too close to the wind
+		{180, 10, 6.5}, // Past the last angle
+		{90, 0, 0},
+	}
+	for _, tc := range tests {
+		if got := p.boatSpeed(tc.twa, tc.tws); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%g at %g kt: %g, want %g", tc.twa, tc.tws, got, tc.want)
+		}
+	}
+
+	// Upwind the best VMG is from the closest angle; a course dead upwind
+	// goes at that VMG by tacking and one on the beam is sailed straight
+	upAngle, up, downAngle, down := p.bestVMG(10)
+	if upAngle != 52 || math.Abs(up-6.6*math.Cos(radians(52))) > 1e-9 || downAngle <= 90 || down <= 0 {
+		t.Errorf("best VMG up %g at %g, down %g at %g", up, upAngle, down, downAngle)
+	}
+	if got := p.courseSpeed(0, 10); math.Abs(got-up) > 1e-9 {
+		t.Errorf("dead upwind %g, want %g", got, up)
+	}
+	if got := p.courseSpeed(90, 10); got != 7.7 {
+		t.Errorf("on the beam %g", got)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import "context"
+import "errors"
+import "fmt"
+import "log"
+import "net/http"
+import "time"
+
+// The start and end lags in models are typical times, and NCEP runs late
+// often enough that they're wrong. Instead ask the server: a run has started
+// when its first forecast's .idx is there and is complete when its last
+// forecast's is. The .idx is written after the GRIB so it's a safe signal.
+
+var probe bool
+
+var errNoProbe = errors.New("model has no probe URL")
+
+// The .idx of a forecast of a run on the server we're fetching from
+func probeUrl(run time.Time, forecast int) (string, error) {
+	pattern := M.probeurl
+	if modelSource() == "mirror" {
+		pattern = M.mirrorurl
+	}
+	data, err := newUrlData(run, forecast, "", "", "")
+	if err != nil {
+		return "", err
+	}
+	url, err := expandUrl(pattern, data)
+	return url + ".idx", err
+}
+
+// HEAD a forecast's .idx - true if it's there, false if it's not (404)
+func probeExists(ctx context.Context, run time.Time, forecast int) (bool, error) {
+	url, err := probeUrl(run, forecast)
+	if err != nil {
+		return false, err
+	}
+	if fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+	}
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return false, err
+	}
+	req.Method = http.MethodHead
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("%s: %s", url, resp.Status)
+}
+
+// The newest run whose last forecast is posted, or if partial whose first
+// forecast is, then prev runs before that. forecastLast is still an
+// estimate from the model's (or learned) end lag.
+func probeRun(ctx context.Context, utc time.Time, prev int, partial bool) (run, forecastLast time.Time, inProgress bool, err error) {
+	if (modelSource() == "mirror" && M.mirrorurl == "") || (modelSource() != "mirror" && M.probeurl == "") {
+		return run, forecastLast, false, errNoProbe
+	}
+	if M.stormurl != "" {
+		return run, forecastLast, false, errNoProbe // Which storms there are depends on the run
+	}
+	_, endLag := modelLags(utc)
+	modelFrequency, _ := time.ParseDuration(M.modelFrequency)
+
+	// Look back far enough to reach a run that should be complete
+	candidates := int(endLag/modelFrequency) + 3
+	newest := utc.Truncate(modelFrequency)
+	for k := 0; k < candidates; k++ {
+		run = newest.Add(-modelFrequency * time.Duration(k))
+		hours := forecastHours(run) // Some cycles go further
+		if len(hours) == 0 {
+			return run, forecastLast, false, fmt.Errorf("no forecast hours")
+		}
+		complete, err := probeExists(ctx, run, hours[len(hours)-1])
+		if err != nil {
+			return run, forecastLast, false, err
+		}
+		started := complete
+		if !complete && partial {
+			if started, err = probeExists(ctx, run, hours[0]); err != nil {
+				return run, forecastLast, false, err
+			}
+		}
+		if verbose {
+			log.Printf("Probe %s %02dz: started %v complete %v\n", Z.model, run.Hour(), started, complete)
+		}
+		if !started {
+			continue
+		}
+		inProgress = !complete
+		if prev > 0 {
+			// Earlier runs are done
+			run = run.Add(-modelFrequency * time.Duration(prev))
+			inProgress = false
+		}
+		_, endLag = modelLags(run)
+		return run, run.Add(endLag), inProgress, nil
+	}
+	return run, forecastLast, false, fmt.Errorf("no %s run posted in the last %d cycles", Z.model, candidates)
+}
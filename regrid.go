@@ -0,0 +1,154 @@
+package main
+
+import "fmt"
+import "math"
+import "strings"
+
+// Resample fields onto a regular lat/lon grid covering the zone. Several
+// routing apps can't read the Lambert conformal grids HRRR and the NAM nests
+// come on.
+
+type Regrid struct {
+	spacing float64 // Degrees between grid points, 0 to leave the grid alone
+	method  string  // "bilinear" (default) or "nearest"
+}
+
+// The regular lat/lon grid covering a zone, north to south like GFS
+func latLonGrid(lon Longitude, lat Latitude, spacing float64, earth []byte) *gribGrid {
+	width := lon.east - lon.west
+	if width <= 0 {
+		width += 360
+	}
+	g := &gribGrid{
+		template: 0,
+		nx:       int(math.Floor(width/spacing+1e-6)) + 1,
+		ny:       int(math.Floor((lat.north-lat.south)/spacing+1e-6)) + 1,
+		scan:     0,
+		resFlags: 0x30, // i and j increments given
+		earth:    earth,
+		la1:      lat.north,
+		lo1:      lon360(lon.west),
+		di:       spacing,
+		dj:       spacing,
+	}
+	g.radius = earthRadius(earth)
+	g.la2, g.lo2 = g.latLon(float64(g.nx-1), float64(g.ny-1))
+	return g
+}
+
+// The value at a fractional index, interpolated from the four neighbours.
+// NaN off the grid or next to missing points.
+func (g *gribGrid) bilinear(vals []float64, i, j float64) float64 {
+	i0, j0 := math.Floor(i), math.Floor(j)
+	fi, fj := i-i0, j-j0
+	at := func(i, j int) float64 {
+		if g.global() {
+			i = (i%g.nx + g.nx) % g.nx
+		}
+		if i < 0 || i >= g.nx || j < 0 || j >= g.ny {
+			return math.NaN()
+		}
+		return vals[j*g.nx+i]
+	}
+	ii, jj := int(i0), int(j0)
+	// Points exactly on a row or column don't need the neighbours past it
+	v := 0.0
+	for _, c := range []struct {
+		di, dj int
+		w      float64
+	}{{0, 0, (1 - fi) * (1 - fj)}, {1, 0, fi * (1 - fj)}, {0, 1, (1 - fi) * fj}, {1, 1, fi * fj}} {
+		if c.w > 0 {
+			v += c.w * at(ii+c.di, jj+c.dj)
+		}
+	}
+	return v
+}
+
+// Directions in degrees as their sines and cosines. Interpolating those
+// goes the short way round - 350 and 10 average to 0, not 180.
+func directionComponents(dirs []float64) (sin, cos []float64) {
+	sin, cos = make([]float64, len(dirs)), make([]float64, len(dirs))
+	for i, d := range dirs {
+		sin[i], cos[i] = math.Sin(radians(d)), math.Cos(radians(d))
+	}
+	return sin, cos
+}
+
+// The direction in degrees of an interpolated sine and cosine
+func componentDirection(sin, cos float64) float64 {
+	return lon360(degrees(math.Atan2(sin, cos)))
+}
+
+// The nearest grid point's value
+func (g *gribGrid) nearest(vals []float64, i, j float64) float64 {
+	ii, jj := int(math.Round(i)), int(math.Round(j))
+	if g.global() {
+		ii = (ii%g.nx + g.nx) % g.nx
+	}
+	if ii < 0 || ii >= g.nx || jj < 0 || jj >= g.ny {
+		return math.NaN()
+	}
+	return vals[jj*g.nx+ii]
+}
+
+// Resample values from src onto dst
+func resample(src *gribGrid, vals []float64, dst *gribGrid, method string) []float64 {
+	out := make([]float64, dst.nx*dst.ny)
+	for j := 0; j < dst.ny; j++ {
+		for i := 0; i < dst.nx; i++ {
+			lat, lon := dst.latLon(float64(i), float64(j))
+			si, sj := src.index(lat, lon)
+			if method == "nearest" {
+				out[j*dst.nx+i] = src.nearest(vals, si, sj)
+			} else {
+				out[j*dst.nx+i] = src.bilinear(vals, si, sj)
+			}
+		}
+	}
+	return out
+}
+
+// The field resampled onto dst, as a message on its own. Integer fields
+// (categorical precipitation, lightning, etc.) always use nearest neighbour;
+// directions are interpolated by their sines and cosines.
+func regridField(f *grib2Field, dst *gribGrid, method string) ([]byte, error) {
+	src, err := f.grid()
+	if err != nil {
+		return nil, err
+	}
+	if !f.unpackable() {
+		return nil, fmt.Errorf("data template 5.%d not supported", f.dataTemplate)
+	}
+	// A wind that couldn't be rotated would point nowhere on a lat/lon grid
+	if src.resFlags&gridRelativeWinds != 0 && windComponent(f) {
+		return nil, fmt.Errorf("winds are grid-relative")
+	}
+	vals, err := f.values()
+	if err != nil {
+		return nil, err
+	}
+	if p, err := parsePacking(f.sec[5]); err == nil && p.origType == 1 && f.dataTemplate != 4 {
+		method = "nearest"
+	}
+	if directionParams[f.name()] && method != "nearest" {
+		sin, cos := directionComponents(vals)
+		sin, cos = resample(src, sin, dst, method), resample(src, cos, dst, method)
+		dirs := make([]float64, len(sin))
+		for i := range dirs {
+			dirs[i] = componentDirection(sin[i], cos[i])
+		}
+		return f.repack(dst.section(), f.sec[4], dirs), nil
+	}
+	return f.repack(dst.section(), f.sec[4], resample(src, vals, dst, method)), nil
+}
+
+func checkRegrid(r Regrid) error {
+	if r.spacing < 0 {
+		return fmt.Errorf("regrid spacing must be positive")
+	}
+	switch strings.ToLower(r.method) {
+	case "", "bilinear", "nearest":
+		return nil
+	}
+	return fmt.Errorf("unknown regrid method '%s'", r.method)
+}
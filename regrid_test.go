@@ -0,0 +1,115 @@
+package main
+
+import "math"
+import "testing"
+
+func TestLatLonGrid(t *testing.T) {
+	g := latLonGrid(Longitude{-123, -121.5}, Latitude{38.5, 37.5}, 0.25, make([]byte, 16))
+	if g.nx != 7 || g.ny != 5 || g.la1 != 38.5 || g.lo1 != 237 || math.Abs(g.la2-37.5) > 1e-9 || math.Abs(g.lo2-238.5) > 1e-9 {
+		t.Errorf("%dx%d %g,%g to %g,%g", g.nx, g.ny, g.la1, g.lo1, g.la2, g.lo2)
+	}
+}
+
+// A field that's linear in lat and lon comes through bilinear interpolation
+// unchanged; nearest neighbour picks the closest source point
+func TestRegridField(t *testing.T) {
+	src := testLatLonGrid(5, 5, 39, 236, 0.5)
+	linear := func(lat, lon float64) float64 { return 10*lat + lon - 2600 }
+	vals := make([]float64, src.nx*src.ny)
+	for j := 0; j < src.ny; j++ {
+		for i := 0; i < src.nx; i++ {
+			lat, lon := src.latLon(float64(i), float64(j))
+			vals[j*src.nx+i] = linear(lat, lon)
+		}
+	}
+	f := parseTestField(t, testMessage(src, 0, 0, 6, 3, vals))
+	dst := latLonGrid(Longitude{-123.5, -122.5}, Latitude{38.5, 37.5}, 0.2, src.earth)
+
+	for _, method := range []string{"bilinear", "nearest"} {
+		msg, err := regridField(f, dst, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := parseTestField(t, msg)
+		g, err := r.grid()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.template != 0 || g.nx != dst.nx || g.ny != dst.ny {
+			t.Errorf("%s: regridded to 3.%d %dx%d", method, g.template, g.nx, g.ny)
+		}
+		got, err := r.values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make([]float64, len(got))
+		for j := 0; j < dst.ny; j++ {
+			for i := 0; i < dst.nx; i++ {
+				lat, lon := dst.latLon(float64(i), float64(j))
+				if method == "nearest" {
+					lat, lon = math.Round(lat*2)/2, math.Round(lon*2)/2
+				}
+				want[j*dst.nx+i] = linear(lat, lon)
+			}
+		}
+		checkValues(t, got, want, 0.002)
+	}
+
+	// Off the source grid is missing
+	off := latLonGrid(Longitude{-122.5, -121.5}, Latitude{38, 37}, 0.5, src.earth)
+	msg, err := regridField(f, off, "bilinear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseTestField(t, msg).values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.IsNaN(got[0]) || !math.IsNaN(got[len(got)-1]) {
+		t.Errorf("off the grid: %v", got)
+	}
+}
+
+// Wind directions of 350 and 10 degrees either side of a column come out
+// as north in it
+func TestRegridDirection(t *testing.T) {
+	src := testLatLonGrid(2, 2, 38, 237, 1)
+	f := parseTestField(t, testMessage(src, 2, 0, 6, 0, []float64{350, 10, 350, 10}))
+	dst := latLonGrid(Longitude{-123, -122}, Latitude{38, 37}, 0.5, src.earth)
+	msg, err := regridField(f, dst, "bilinear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseTestField(t, msg).values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float64{350, 0, 10, 350, 0, 10, 350, 0, 10} {
+		if math.Abs(math.Remainder(got[i]-want, 360)) > 0.5 {
+			t.Errorf("value %d = %g, want %g", i, got[i], want)
+		}
+	}
+}
+
+// A wind flagged grid-relative can't be regridded; anything else loses the
+// flag on the lat/lon grid
+func TestRegridGridRelative(t *testing.T) {
+	src := testLatLonGrid(3, 3, 38, 237, 0.5)
+	src.resFlags |= gridRelativeWinds
+	vals := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	dst := latLonGrid(Longitude{-122.75, -122.25}, Latitude{37.75, 37.25}, 0.25, src.earth)
+	if _, err := regridField(parseTestField(t, testMessage(src, 2, 2, 6, 0, vals)), dst, "bilinear"); err == nil {
+		t.Error("grid-relative U regridded")
+	}
+	msg, err := regridField(parseTestField(t, testMessage(src, 0, 0, 6, 0, vals)), dst, "bilinear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := parseTestField(t, msg).grid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.resFlags&gridRelativeWinds != 0 {
+		t.Errorf("regridded flags %#x", g.resFlags)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import "fmt"
+import "log"
+import "math"
+
+// HRRR and the NAM nests give U and V relative to their Lambert conformal
+// grid (resolution and component flags bit 5), not east and north. Apps
+// that assume earth-relative winds get directions that are off by up to
+// cone * (lon - LoV) - many degrees at the edges of the domain.
+
+var earthWinds bool
+
+// Vector pairs that can be grid-relative, U then V (discipline 0, category 2)
+var windPairs = [][2]int{
+	{2, 3},     // UGRD, VGRD
+	{194, 195}, // USTM, VSTM
+}
+
+// Is f the U or V of a pair that can be grid-relative?
+func windComponent(f *grib2Field) bool {
+	if f.msg.discipline != 0 || f.category != 2 {
+		return false
+	}
+	for _, pair := range windPairs {
+		if f.parameter == pair[0] || f.parameter == pair[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields that match apart from the parameter - same grid, level, time, member
+func vectorKey(f *grib2Field) string {
+	sec4 := append([]byte{}, f.sec[4]...)
+	sec4[10] = 0
+	return string(f.sec[3]) + string(sec4)
+}
+
+// Rotate grid-relative wind pairs to earth-relative. Other fields, and
+// winds that are already earth-relative, pass through unchanged.
+func rotateWinds(fields []*grib2Field) []*grib2Field {
+	out := append([]*grib2Field{}, fields...)
+	for _, pair := range windPairs {
+		vs := map[string]int{}
+		for n, f := range out {
+			if f.msg.discipline == 0 && f.category == 2 && f.parameter == pair[1] {
+				vs[vectorKey(f)] = n
+			}
+		}
+		for n, f := range out {
+			if f.msg.discipline != 0 || f.category != 2 || f.parameter != pair[0] {
+				continue
+			}
+			m, ok := vs[vectorKey(f)]
+			if !ok {
+				continue
+			}
+			u, v, err := rotatePair(f, out[m])
+			if err != nil {
+				log.Printf("Can't rotate %s: %v\n", f, err)
+				continue
+			}
+			if u != nil {
+				out[n], out[m] = u, v
+			}
+		}
+	}
+	return out
+}
+
+// Earth-relative versions of a U/V pair, nil if they already are
+func rotatePair(uf, vf *grib2Field) (*grib2Field, *grib2Field, error) {
+	g, err := uf.grid()
+	if err != nil {
+		return nil, nil, err
+	}
+	if g.resFlags&gridRelativeWinds == 0 {
+		return nil, nil, nil
+	}
+	if !uf.unpackable() || !vf.unpackable() {
+		return nil, nil, fmt.Errorf("data template 5.%d not supported", uf.dataTemplate)
+	}
+	u, err := uf.values()
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := vf.values()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// On a lat/lon grid grid-relative is earth-relative; only the flag changes
+	if g.template == 30 {
+		for j := 0; j < g.ny; j++ {
+			for i := 0; i < g.nx; i++ {
+				_, lon := g.latLon(float64(i), float64(j))
+				angle := g.cone * radians(lon360(lon-g.lov+180)-180)
+				sin, cos := math.Sincos(angle)
+				k := j*g.nx + i
+				u[k], v[k] = cos*u[k]+sin*v[k], -sin*u[k]+cos*v[k]
+			}
+		}
+	}
+	earth := *g
+	earth.resFlags &^= gridRelativeWinds
+	sec3 := earth.section()
+	un, err := parseGrib2Message(uf.repack(sec3, uf.sec[4], u), 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	vn, err := parseGrib2Message(vf.repack(sec3, vf.sec[4], v), 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return un.fields[0], vn.fields[0], nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import "math"
+import "testing"
+
+// Grid-relative winds at the first point of an HRRR-like grid, 122.5W -
+// 25 degrees west of LoV. wgrib2 -new_grid_winds earth turns them by
+// sin(38.5) * (lon - LoV) = -15.563 degrees.
+func TestRotateWinds(t *testing.T) {
+	g := &gribGrid{template: 30, nx: 2, ny: 2, resFlags: gridRelativeWinds, earth: make([]byte, 16),
+		la1: 38, lo1: 237.5, lad: 38.5, lov: 262.5, dx: 3000, dy: 3000,
+		latin1: 38.5, latin2: 38.5, scan: 0x40, pole: make([]byte, 8)}
+	g.earth[0] = 6
+	g.radius = earthRadius(g.earth)
+	g.lambertSetup()
+
+	tests := []struct {
+		u, v   float64
+		ue, ve float64
+	}{
+		{10, 0, 9.633, 2.683},
+		{0, 10, -2.683, 9.633},
+		{-5, -5, -3.475, -6.158},
+	}
+	for _, tc := range tests {
+		u := []float64{tc.u, tc.u, tc.u, tc.u}
+		v := []float64{tc.v, tc.v, tc.v, tc.v}
+		fields := []*grib2Field{
+			parseTestField(t, testMessage(g, 2, 2, 6, 3, u)),
+			parseTestField(t, testMessage(g, 2, 3, 6, 3, v)),
+		}
+		earth := rotateWinds(fields)
+		var got [2][]float64
+		for n := range got {
+			eg, err := earth[n].grid()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if eg.resFlags&gridRelativeWinds != 0 {
+				t.Errorf("%s still grid-relative", earth[n])
+			}
+			if got[n], err = earth[n].values(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if math.Abs(got[0][0]-tc.ue) > 0.002 || math.Abs(got[1][0]-tc.ve) > 0.002 {
+			t.Errorf("%g,%g rotated to %.3f,%.3f, want %.3f,%.3f", tc.u, tc.v, got[0][0], got[1][0], tc.ue, tc.ve)
+		}
+		// The speed doesn't change anywhere on the grid
+		for k := range u {
+			if s := math.Hypot(got[0][k], got[1][k]); math.Abs(s-math.Hypot(tc.u, tc.v)) > 0.002 {
+				t.Errorf("%g,%g: speed %.3f at point %d", tc.u, tc.v, s, k)
+			}
+		}
+	}
+
+	// Earth-relative winds, and a U without its V, pass through
+	g.resFlags = 0
+	u := parseTestField(t, testMessage(g, 2, 2, 6, 3, []float64{10, 10, 10, 10}))
+	v := parseTestField(t, testMessage(g, 2, 3, 6, 3, []float64{0, 0, 0, 0}))
+	if out := rotateWinds([]*grib2Field{u, v}); out[0] != u || out[1] != v {
+		t.Error("earth-relative winds were rotated")
+	}
+	g.resFlags = gridRelativeWinds
+	u = parseTestField(t, testMessage(g, 2, 2, 6, 3, []float64{10, 10, 10, 10}))
+	if out := rotateWinds([]*grib2Field{u}); out[0] != u {
+		t.Error("U on its own was rotated")
+	}
+}
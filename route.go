@@ -0,0 +1,392 @@
+package main
+
+import "context"
+import "encoding/xml"
+import "flag"
+import "fmt"
+import "log"
+import "math"
+import "os"
+import "path/filepath"
+import "strconv"
+import "strings"
+import "time"
+
+// nomads route -region paccup,paccup-wave -course race.gpx -start 2026-07-06T18:00Z [-speed 7 | -polar boat.pol]
+//
+// The forecast along a course rather than over a box. Reads the waypoints
+// of a GPX route (or track, or waypoints) or a KML LineString, sails them
+// from the start time at a constant speed or at the polar speed for the
+// forecast wind - tacking or gybing when the leg is too close to the wind -
+// with any forecast current helping or hindering along the course, and
+// prints the wind, waves and current at each waypoint's ETA from the
+// regions' newest composites (or -file).
+
+const earthRadiusNm = 3440.065
+
+// How often the boat's speed is worked out again along a leg
+const routeStep = 10 * time.Minute
+
+type waypoint struct {
+	name     string
+	lat, lon float64
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Name string  `xml:"name,omitempty"`
+	Time string  `xml:"time,omitempty"`
+}
+
+type gpxFile struct {
+	Rte []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+	Trk []struct {
+		Segs []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Wpt []gpxPoint `xml:"wpt"`
+}
+
+// The course's waypoints: a GPX route, else its track, else its waypoints,
+// or a KML file's first LineString
+func readCourse(fn string) ([]waypoint, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var wps []waypoint
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".gpx":
+		var g gpxFile
+		if err := xml.Unmarshal(data, &g); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+		var pts []gpxPoint
+		switch {
+		case len(g.Rte) > 0:
+			pts = g.Rte[0].Points
+		case len(g.Trk) > 0:
+			for _, seg := range g.Trk[0].Segs {
+				pts = append(pts, seg.Points...)
+			}
+		default:
+			pts = g.Wpt
+		}
+		for _, p := range pts {
+			wps = append(wps, waypoint{p.Name, p.Lat, p.Lon})
+		}
+	case ".kml":
+		if wps, err = kmlLineString(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: not a .gpx or .kml file", fn)
+	}
+	if len(wps) < 2 {
+		return nil, fmt.Errorf("%s: a course needs at least two points", fn)
+	}
+	for i := range wps {
+		if wps[i].name == "" {
+			wps[i].name = fmt.Sprintf("WP%d", i)
+		}
+	}
+	return wps, nil
+}
+
+// The coordinates (lon,lat[,alt] ...) of the first LineString
+func kmlLineString(data []byte) ([]waypoint, error) {
+	d := xml.NewDecoder(strings.NewReader(string(data)))
+	inLine, inCoords := false, false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("no LineString")
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "LineString":
+				inLine = true
+			case "coordinates":
+				inCoords = inLine
+			}
+		case xml.EndElement:
+			if t.Name.Local == "LineString" {
+				inLine = false
+			}
+			inCoords = false
+		case xml.CharData:
+			if !inCoords {
+				continue
+			}
+			var wps []waypoint
+			for _, c := range strings.Fields(string(t)) {
+				parts := strings.Split(c, ",")
+				if len(parts) < 2 {
+					return nil, fmt.Errorf("bad coordinate '%s'", c)
+				}
+				lon, err1 := strconv.ParseFloat(parts[0], 64)
+				lat, err2 := strconv.ParseFloat(parts[1], 64)
+				if err1 != nil || err2 != nil {
+					return nil, fmt.Errorf("bad coordinate '%s'", c)
+				}
+				wps = append(wps, waypoint{lat: lat, lon: lon})
+			}
+			return wps, nil
+		}
+	}
+}
+
+// Great circle distance in nautical miles
+func gcDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	p1, p2 := radians(lat1), radians(lat2)
+	dp, dl := p2-p1, radians(lon2-lon1)
+	a := math.Sin(dp/2)*math.Sin(dp/2) + math.Cos(p1)*math.Cos(p2)*math.Sin(dl/2)*math.Sin(dl/2)
+	return 2 * earthRadiusNm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Initial great circle bearing, degrees true
+func gcBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	p1, p2, dl := radians(lat1), radians(lat2), radians(lon2-lon1)
+	y := math.Sin(dl) * math.Cos(p2)
+	x := math.Cos(p1)*math.Sin(p2) - math.Sin(p1)*math.Cos(p2)*math.Cos(dl)
+	return lon360(degrees(math.Atan2(y, x)))
+}
+
+// The point nm along a bearing
+func gcDestination(lat, lon, bearing, nm float64) (float64, float64) {
+	p1, l1, b, d := radians(lat), radians(lon), radians(bearing), nm/earthRadiusNm
+	p2 := math.Asin(math.Sin(p1)*math.Cos(d) + math.Cos(p1)*math.Sin(d)*math.Cos(b))
+	l2 := l1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(p1), math.Cos(d)-math.Sin(p1)*math.Sin(p2))
+	return degrees(p2), lon360(degrees(l2)+180) - 180
+}
+
+// Wind (or current) speed and the direction it's from (to, for currents)
+// in degrees true
+func vectorDirection(u, v float64, from bool) (speed, dir float64) {
+	if from {
+		u, v = -u, -v
+	}
+	return math.Hypot(u, v), lon360(degrees(math.Atan2(u, v))) + 0 // Not -0
+}
+
+// The angle between a heading and the wind direction, 0-180
+func windAngle(heading, twd float64) float64 {
+	a := math.Abs(lon360(twd - heading))
+	if a > 180 {
+		a = 360 - a
+	}
+	return a
+}
+
+// The forecast at a place and time, from the first series that has each
+// variable. Speeds in knots, NaN where there's no forecast. Winds and
+// currents come from their interpolated U and V, the wave direction from
+// the series' direction-aware interpolation.
+type conditions struct {
+	tws, twd, gust  float64
+	hs, tp, waveDir float64
+	drift, set      float64 // Current speed and direction it flows to
+}
+
+func conditionsAt(series []*gribSeries, t time.Time, lat, lon float64) conditions {
+	get := func(key string) float64 {
+		for _, s := range series {
+			if v := s.value(key, t, lat, lon); !math.IsNaN(v) {
+				return v
+			}
+		}
+		return math.NaN()
+	}
+	var c conditions
+	c.tws, c.twd = vectorDirection(get("UGRD:10_m_above_ground"), get("VGRD:10_m_above_ground"), true)
+	c.tws /= metresPerSecondPerKnot
+	c.gust = get("GUST:surface") / metresPerSecondPerKnot
+	c.hs = get("HTSGW:surface")
+	c.tp = get("PERPW:surface")
+	c.waveDir = get("DIRPW:surface")
+	c.drift, c.set = vectorDirection(get("UOGRD:0_m_below_sea_level"), get("VOGRD:0_m_below_sea_level"), false)
+	c.drift /= metresPerSecondPerKnot
+	return c
+}
+
+// Boat speed along a heading: from the polar when there is one and the
+// wind is known, else the constant speed
+func sailingSpeed(p *polar, constant, heading float64, c conditions) float64 {
+	if p == nil || math.IsNaN(c.tws) {
+		return constant
+	}
+	return p.courseSpeed(windAngle(heading, c.twd), c.tws)
+}
+
+// Speed over the ground along a heading. The boat steers up into any cross
+// current to stay on the line; the current along it adds or takes away.
+func groundSpeed(bsp, heading float64, c conditions) float64 {
+	if math.IsNaN(c.drift) || c.drift == 0 {
+		return bsp
+	}
+	a := radians(c.set - heading)
+	cross, along := c.drift*math.Sin(a), c.drift*math.Cos(a)
+	if math.Abs(cross) >= bsp {
+		return along // Swept off the line
+	}
+	return math.Sqrt(bsp*bsp-cross*cross) + along
+}
+
+type courseETA struct {
+	wp       waypoint
+	distance float64 // From the previous waypoint, nm
+	bearing  float64 // Of the next leg (the last for the finish)
+	eta      time.Time
+}
+
+// Sail the course from start, working out the speed every routeStep
+func courseETAs(wps []waypoint, start time.Time, series []*gribSeries, p *polar, constant float64) []courseETA {
+	etas := []courseETA{{wp: wps[0], eta: start}}
+	t := start
+	for k := 1; k < len(wps); k++ {
+		lat, lon := wps[k-1].lat, wps[k-1].lon
+		dest := wps[k]
+		legDistance := gcDistance(lat, lon, dest.lat, dest.lon)
+		etas[k-1].bearing = gcBearing(lat, lon, dest.lat, dest.lon)
+		for remaining := legDistance; remaining > 1e-6; {
+			heading := gcBearing(lat, lon, dest.lat, dest.lon)
+			c := conditionsAt(series, t, lat, lon)
+			speed := math.Max(groundSpeed(sailingSpeed(p, constant, heading, c), heading, c), 0.5) // Drifting
+			step := speed * routeStep.Hours()
+			if step >= remaining {
+				t = t.Add(time.Duration(remaining / speed * float64(time.Hour)))
+				break
+			}
+			lat, lon = gcDestination(lat, lon, heading, step)
+			remaining = gcDistance(lat, lon, dest.lat, dest.lon)
+			t = t.Add(routeStep)
+		}
+		etas = append(etas, courseETA{wp: dest, distance: legDistance, bearing: etas[k-1].bearing, eta: t})
+	}
+	return etas
+}
+
+// Start time: RFC 3339 or a cycle-style UTC time like 2026-07-06T18Z
+func parseStart(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range runLayouts {
+		if t, err := time.Parse(layout, strings.ToUpper(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad start time %q: use 2026-07-06T18:00Z", s)
+}
+
+// The newest composites of the regions, or the files
+func loadSeriesList(regions, files string) ([]*gribSeries, error) {
+	var fns []string
+	if files != "" {
+		fns = strings.Split(files, ",")
+	} else if regions != "" {
+		for _, id := range strings.Split(regions, ",") {
+			if _, ok := zones[id]; !ok {
+				return nil, fmt.Errorf("unknown region '%s'", id)
+			}
+			fn, err := latestComposite(context.Background(), grb2Directory(), id)
+			if err != nil {
+				return nil, err
+			}
+			fns = append(fns, fn)
+		}
+	} else {
+		return nil, fmt.Errorf("no -region or -file")
+	}
+	var series []*gribSeries
+	for _, fn := range fns {
+		s, err := loadSeries(fn)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Forecast %s (%s to %s)\n", filepath.Base(fn), s.times[0].Format("2006-01-02 15z"), s.times[len(s.times)-1].Format("2006-01-02 15z"))
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// A table cell, - for no forecast
+func cell(format string, v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf(format, v)
+}
+
+func routeCommand(arguments []string) {
+	fs := flag.NewFlagSet("route", flag.ExitOnError)
+	regions := fs.String("region", "", "Regions whose newest composites to read (comma separated, e.g. wind then waves)")
+	files := fs.String("file", "", "Composites to read instead (comma separated)")
+	course := fs.String("course", "", "Course: GPX route/track/waypoints or KML LineString")
+	startFlag := fs.String("start", "", "Start time, e.g. 2026-07-06T18:00Z")
+	speed := fs.Float64("speed", 6, "Boat speed in knots, or when the polar has no wind")
+	polarFile := fs.String("polar", "", "Polar file (tab-separated TWA/TWS table) for boat speed from the forecast wind")
+	tz := fs.String("tz", "Local", "Time zone for local times")
+	fs.StringVar(&stormFlag, "storm", "", "Storm ID (05L) or name for per-storm zones (HAFS)")
+	fs.StringVar(&configFile, "config", "", "Zone & model config file (JSON or TOML) merged over the built-in definitions")
+	fs.Parse(arguments)
+
+	fail := func(err error) {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+	if err := loadConfigs(); err != nil {
+		fail(fmt.Errorf("Config: %v", err))
+	}
+	if *course == "" || *startFlag == "" {
+		fail(fmt.Errorf("-course and -start are required"))
+	}
+	wps, err := readCourse(*course)
+	if err != nil {
+		fail(err)
+	}
+	start, err := parseStart(*startFlag)
+	if err != nil {
+		fail(err)
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		fail(err)
+	}
+	var p *polar
+	if *polarFile != "" {
+		if p, err = readPolar(*polarFile); err != nil {
+			fail(err)
+		}
+	}
+	if *speed <= 0 {
+		fail(fmt.Errorf("-speed must be positive"))
+	}
+	series, err := loadSeriesList(*regions, *files)
+	if err != nil {
+		fail(err)
+	}
+
+	total := 0.0
+	fmt.Printf("%-14s %7s %7s %4s  %-17s %-17s %5s %4s %4s %5s %5s %5s %4s %5s %5s %5s %4s\n",
+		"waypoint", "leg nm", "tot nm", "brg", "ETA UTC", "ETA local", "tws", "twd", "twa", "gust", "bsp", "sog", "hs m", "tp", "wvdir", "drift", "set")
+	for _, e := range courseETAs(wps, start, series, p, *speed) {
+		total += e.distance
+		c := conditionsAt(series, e.eta, e.wp.lat, e.wp.lon)
+		twa := math.NaN()
+		if !math.IsNaN(c.twd) && !math.IsNaN(c.tws) {
+			twa = windAngle(e.bearing, c.twd)
+		}
+		bsp := sailingSpeed(p, *speed, e.bearing, c)
+		fmt.Printf("%-14s %7.1f %7.1f %4.0f  %-17s %-17s %5s %4s %4s %5s %5.1f %5.1f %5s %4s %5s %5s %4s\n",
+			e.wp.name, e.distance, total, e.bearing, e.eta.Format("2006-01-02 15:04"), e.eta.In(loc).Format("2006-01-02 15:04"),
+			cell("%.1f", c.tws), cell("%.0f", c.twd), cell("%.0f", twa), cell("%.1f", c.gust),
+			bsp, groundSpeed(bsp, e.bearing, c), cell("%.1f", c.hs), cell("%.0f", c.tp), cell("%.0f", c.waveDir),
+			cell("%.1f", c.drift), cell("%.0f", c.set))
+	}
+}
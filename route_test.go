@@ -0,0 +1,178 @@
+package main
+
+import "math"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+func TestReadCourse(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, text string
+		want       []waypoint
+	}{
+		{"route.gpx", `<gpx><wpt lat="1" lon="1"/><rte><rtept lat="37.8" lon="-122.5"><name>GG</name></rtept><rtept lat="37.7" lon="-123"/></rte></gpx>`,
+			[]waypoint{{"GG", 37.8, -122.5}, {"WP1", 37.7, -123}}},
+		{"track.gpx", `<gpx><trk><trkseg><trkpt lat="37.8" lon="-122.5"/></trkseg><trkseg><trkpt lat="37.7" lon="-123"/></trkseg></trk></gpx>`,
+			[]waypoint{{"WP0", 37.8, -122.5}, {"WP1", 37.7, -123}}},
+		{"marks.gpx", `<gpx><wpt lat="37.8" lon="-122.5"><name>A</name></wpt><wpt lat="37.7" lon="-123"><name>B</name></wpt></gpx>`,
+			[]waypoint{{"A", 37.8, -122.5}, {"B", 37.7, -123}}},
+		{"course.kml", `<kml><Document><Placemark><LineString><coordinates>-122.5,37.8,0 -123,37.7,0</coordinates></LineString></Placemark></Document></kml>`,
+			[]waypoint{{"WP0", 37.8, -122.5}, {"WP1", 37.7, -123}}},
+	}
+	for _, tc := range tests {
+		fn := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(fn, []byte(tc.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readCourse(fn)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: %v", tc.name, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: %v, want %v", tc.name, got[i], tc.want[i])
+			}
+		}
+	}
+
+	for name, text := range map[string]string{
+		"one.gpx":   `<gpx><rte><rtept lat="37.8" lon="-122.5"/></rte></gpx>`,
+		"bad.kml":   `<kml><LineString><coordinates>-122.5</coordinates></LineString></kml>`,
+		"none.kml":  `<kml><Point><coordinates>-122.5,37.8</coordinates></Point></kml>`,
+		"route.txt": `37.8,-122.5`,
+	} {
+		fn := filepath.Join(dir, name)
+		if err := os.WriteFile(fn, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readCourse(fn); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestGreatCircle(t *testing.T) {
+	// A degree of latitude is 60 miles, due north
+	if d := gcDistance(37, -122, 38, -122); math.Abs(d-60.04) > 0.01 {
+		t.Errorf("distance %g", d)
+	}
+	if b := gcBearing(37, -122, 38, -122); math.Abs(b) > 1e-9 {
+		t.Errorf("bearing %g", b)
+	}
+	if b := gcBearing(0, 0, 0, -1); math.Abs(b-270) > 1e-9 {
+		t.Errorf("bearing west %g", b)
+	}
+	lat, lon := gcDestination(37, -122, 90, 30)
+	if math.Abs(gcDistance(37, -122, lat, lon)-30) > 1e-6 || lon <= -122 || lat >= 37 {
+		t.Errorf("30 miles east %g,%g", lat, lon)
+	}
+}
+
+func TestVectorDirection(t *testing.T) {
+	tests := []struct {
+		u, v       float64
+		from       bool
+		speed, dir float64
+	}{
+		{0, -10, true, 10, 0},  // Northerly
+		{-10, 0, true, 10, 90}, // Easterly
+		{3, 4, true, 5, 216.87},
+		{0, -10, false, 10, 180}, // Current setting south
+	}
+	for _, tc := range tests {
+		speed, dir := vectorDirection(tc.u, tc.v, tc.from)
+		if math.Abs(speed-tc.speed) > 1e-9 || math.Abs(dir-tc.dir) > 0.01 {
+			t.Errorf("%g,%g: %g from %g, want %g from %g", tc.u, tc.v, speed, dir, tc.speed, tc.dir)
+		}
+	}
+	for _, tc := range []struct{ heading, twd, want float64 }{{0, 45, 45}, {350, 10, 20}, {90, 270, 180}, {270, 300, 30}} {
+		if got := windAngle(tc.heading, tc.twd); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("heading %g wind %g: %g, want %g", tc.heading, tc.twd, got, tc.want)
+		}
+	}
+}
+
+func TestParseStart(t *testing.T) {
+	want := time.Date(2026, 7, 6, 18, 0, 0, 0, time.UTC)
+	for _, s := range []string{"2026-07-06T18:00Z", "2026-07-06T18z", "2026-07-06T11:00:00-07:00"} {
+		if got, err := parseStart(s); err != nil || !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("%s: %v %v", s, got, err)
+		}
+	}
+	if _, err := parseStart("tomorrow"); err == nil {
+		t.Error("tomorrow: no error")
+	}
+}
+
+// 60 miles north then 30 back at 6 knots with no forecast
+func TestCourseETAs(t *testing.T) {
+	start := time.Date(2026, 7, 6, 18, 0, 0, 0, time.UTC)
+	wps := []waypoint{{"A", 37, -122}, {"B", 38, -122}, {"C", 37.5, -122}}
+	etas := courseETAs(wps, start, nil, nil, 6)
+	if len(etas) != 3 {
+		t.Fatalf("%d ETAs", len(etas))
+	}
+	leg1 := gcDistance(37, -122, 38, -122)
+	leg2 := gcDistance(38, -122, 37.5, -122)
+	want := []time.Time{start, start.Add(time.Duration(leg1 / 6 * float64(time.Hour))), start.Add(time.Duration((leg1 + leg2) / 6 * float64(time.Hour)))}
+	for i, e := range etas {
+		if d := e.eta.Sub(want[i]); d < -time.Second || d > time.Second {
+			t.Errorf("%s ETA %v, want %v", e.wp.name, e.eta, want[i])
+		}
+	}
+	if math.Abs(etas[0].bearing) > 1e-6 || math.Abs(etas[1].bearing-180) > 1e-6 || etas[1].distance != leg1 {
+		t.Errorf("legs %+v", etas)
+	}
+}
+
+// Waves from 350 degrees on one side of the grid and 10 on the other come
+// from the north halfway between
+func TestConditionsAtWaveDirection(t *testing.T) {
+	g := testLatLonGrid(2, 2, 38, 237, 1)
+	sec4 := testProduct(0, 10, 6) // DIRPW in discipline 10
+	sec4[22], sec4[27] = 1, 0     // At the surface
+	sec5, sec6, sec7 := packValues(simplePacking(0), []float64{350, 10, 350, 10})
+	fn := filepath.Join(t.TempDir(), "waves.grb2")
+	if err := os.WriteFile(fn, gribMessage(10, testIdentification(), g.section(), sec4, sec5, sec6, sec7), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSeries(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 7, 6, 18, 0, 0, 0, time.UTC)
+	c := conditionsAt([]*gribSeries{s}, at, 37.5, -122.5)
+	if math.IsNaN(c.waveDir) || math.Abs(math.Remainder(c.waveDir, 360)) > 0.1 {
+		t.Errorf("waves from %g, want 0", c.waveDir)
+	}
+	if !math.IsNaN(c.tws) || !math.IsNaN(c.hs) {
+		t.Errorf("wind %g and waves %g m from a direction", c.tws, c.hs)
+	}
+}
+
+// 6 knots through the water heading north in a knot of current
+func TestGroundSpeed(t *testing.T) {
+	tests := []struct {
+		drift, set, want float64
+	}{
+		{1, 90, math.Sqrt(35)}, // Steering up into it
+		{1, 0, 7},
+		{1, 180, 5},
+		{math.NaN(), 0, 6},
+		{0, 90, 6},
+		{8, 120, -4}, // Swept off the line
+	}
+	for _, tc := range tests {
+		c := conditions{drift: tc.drift, set: tc.set}
+		if got := groundSpeed(6, 0, c); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%g kt setting %g: %g, want %g", tc.drift, tc.set, got, tc.want)
+		}
+	}
+}
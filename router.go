@@ -0,0 +1,270 @@
+package main
+
+import "encoding/xml"
+import "flag"
+import "fmt"
+import "log"
+import "math"
+import "os"
+import "strconv"
+import "strings"
+import "time"
+
+// nomads router -region paccup,paccup-current -polar boat.pol -from 37.8,-122.7 -to 21.3,-157.9 -start 2026-07-06T18Z
+//
+// Isochrone routing through a fetched run. From each point the boat could
+// have reached by the last step it sails every heading for another step at
+// the polar speed for the forecast wind, plus any forecast current. Of the
+// new points only the one furthest from the start in each sector (bearing
+// from the start) is kept. The first isochrone to get within a step of the
+// finish gives the route, written as a GPX route and printed step by step.
+// There's no land in the model - check the route against a chart.
+
+// Sector width when thinning an isochrone, degrees
+const isochroneSector = 2.0
+
+type isoNode struct {
+	lat, lon float64
+	parent   *isoNode
+	heading  float64
+	bsp      float64 // Boat speed through the water, knots
+	c        conditions
+}
+
+// Wind and current at a place and time. The router doesn't need the rest
+// of conditionsAt, and calls this a lot.
+func routingConditions(series []*gribSeries, t time.Time, lat, lon float64) conditions {
+	get := func(key string) float64 {
+		for _, s := range series {
+			if v := s.value(key, t, lat, lon); !math.IsNaN(v) {
+				return v
+			}
+		}
+		return math.NaN()
+	}
+	c := conditions{gust: math.NaN(), hs: math.NaN(), tp: math.NaN(), waveDir: math.NaN()}
+	c.tws, c.twd = vectorDirection(get("UGRD:10_m_above_ground"), get("VGRD:10_m_above_ground"), true)
+	c.tws /= metresPerSecondPerKnot
+	c.drift, c.set = vectorDirection(get("UOGRD:0_m_below_sea_level"), get("VOGRD:0_m_below_sea_level"), false)
+	c.drift /= metresPerSecondPerKnot
+	return c
+}
+
+// Where sailing a heading for dt gets to, with the current
+func sail(n *isoNode, heading, bsp float64, dt time.Duration) (lat, lon float64) {
+	lat, lon = gcDestination(n.lat, n.lon, heading, bsp*dt.Hours())
+	if !math.IsNaN(n.c.drift) && n.c.drift > 0 {
+		lat, lon = gcDestination(lat, lon, n.c.set, n.c.drift*dt.Hours())
+	}
+	return lat, lon
+}
+
+// The next isochrone from this one, thinned to the furthest point in each
+// sector
+func nextIsochrone(iso []*isoNode, start waypoint, t time.Time, dt time.Duration, series []*gribSeries, p *polar, headingStep float64) []*isoNode {
+	best := map[int]*isoNode{}
+	bestDist := map[int]float64{}
+	for _, n := range iso {
+		n.c = routingConditions(series, t, n.lat, n.lon)
+		if math.IsNaN(n.c.tws) {
+			continue
+		}
+		for h := 0.0; h < 360; h += headingStep {
+			bsp := p.boatSpeed(windAngle(h, n.c.twd), n.c.tws)
+			if bsp <= 0 {
+				continue
+			}
+			lat, lon := sail(n, h, bsp, dt)
+			d := gcDistance(start.lat, start.lon, lat, lon)
+			sector := int(gcBearing(start.lat, start.lon, lat, lon) / isochroneSector)
+			if d > bestDist[sector] {
+				best[sector] = &isoNode{lat: lat, lon: lon, parent: n, heading: h, bsp: bsp}
+				bestDist[sector] = d
+			}
+		}
+	}
+	var next []*isoNode
+	for _, n := range best {
+		next = append(next, n)
+	}
+	return next
+}
+
+// The time to sail straight from a node to the finish, if it's within dt,
+// at the speed over the ground with the node's current
+func finishFrom(n *isoNode, finish waypoint, dt time.Duration, p *polar) (time.Duration, bool) {
+	if math.IsNaN(n.c.tws) {
+		return 0, false
+	}
+	heading := gcBearing(n.lat, n.lon, finish.lat, finish.lon)
+	sog := groundSpeed(p.courseSpeed(windAngle(heading, n.c.twd), n.c.tws), heading, n.c)
+	if sog <= 0 {
+		return 0, false
+	}
+	d := gcDistance(n.lat, n.lon, finish.lat, finish.lon)
+	need := time.Duration(d / sog * float64(time.Hour))
+	return need, need <= dt
+}
+
+type routeStepInfo struct {
+	t    time.Time
+	node *isoNode
+}
+
+// The fastest route, as the node at each step from the start, and the
+// finish time
+func isochroneRoute(start, finish waypoint, departure time.Time, dt, limit time.Duration, series []*gribSeries, p *polar, headingStep float64) ([]routeStepInfo, time.Time, error) {
+	iso := []*isoNode{{lat: start.lat, lon: start.lon}}
+	for t := departure; t.Sub(departure) < limit; t = t.Add(dt) {
+		next := nextIsochrone(iso, start, t, dt, series, p, headingStep)
+
+		// Could any point of this isochrone finish within the step?
+		var arrival time.Time
+		var last *isoNode
+		for _, n := range iso {
+			if need, ok := finishFrom(n, finish, dt, p); ok && (last == nil || t.Add(need).Before(arrival)) {
+				arrival, last = t.Add(need), n
+			}
+		}
+		if last != nil {
+			var nodes []*isoNode
+			for n := last; n != nil; n = n.parent {
+				nodes = append([]*isoNode{n}, nodes...)
+			}
+			var steps []routeStepInfo
+			for i, n := range nodes {
+				steps = append(steps, routeStepInfo{departure.Add(time.Duration(i) * dt), n})
+			}
+			return steps, arrival, nil
+		}
+		if len(next) == 0 {
+			return nil, time.Time{}, fmt.Errorf("no wind forecast after %s", t.Format("2006-01-02 15:04z"))
+		}
+		iso = next
+		if verbose {
+			log.Printf("%s: %d points\n", t.Add(dt).Format("2006-01-02 15:04z"), len(iso))
+		}
+	}
+	return nil, time.Time{}, fmt.Errorf("no route within %s", limit)
+}
+
+// lat,lon
+func parseLatLon(s string) (waypoint, error) {
+	lat, lon, ok := strings.Cut(s, ",")
+	la, err1 := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	lo, err2 := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if !ok || err1 != nil || err2 != nil || math.Abs(la) > 90 {
+		return waypoint{}, fmt.Errorf("bad position '%s' (want lat,lon)", s)
+	}
+	return waypoint{lat: la, lon: lo}, nil
+}
+
+type gpxRoute struct {
+	XMLName xml.Name `xml:"gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Rte     struct {
+		Name   string     `xml:"name"`
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+func writeRouteGPX(fn string, steps []routeStepInfo, finish waypoint, arrival time.Time) error {
+	g := gpxRoute{Version: "1.1", Creator: "nomads", Xmlns: "http://www.topografix.com/GPX/1/1"}
+	g.Rte.Name = "Isochrone route " + steps[0].t.Format("2006-01-02 15:04z")
+	for i, st := range steps {
+		g.Rte.Points = append(g.Rte.Points, gpxPoint{Lat: math.Round(st.node.lat*1e5) / 1e5, Lon: math.Round(st.node.lon*1e5) / 1e5, Name: fmt.Sprintf("%03d", i), Time: st.t.Format(time.RFC3339)})
+	}
+	g.Rte.Points = append(g.Rte.Points, gpxPoint{Lat: finish.lat, Lon: finish.lon, Name: "Finish", Time: arrival.Format(time.RFC3339)})
+	data, err := xml.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fn, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+func routerCommand(arguments []string) {
+	fs := flag.NewFlagSet("router", flag.ExitOnError)
+	regions := fs.String("region", "", "Regions whose newest composites to read (comma separated, e.g. wind then currents)")
+	files := fs.String("file", "", "Composites to read instead (comma separated)")
+	polarFile := fs.String("polar", "", "Polar file (tab-separated TWA/TWS table)")
+	from := fs.String("from", "", "Start as lat,lon")
+	to := fs.String("to", "", "Finish as lat,lon")
+	startFlag := fs.String("start", "", "Departure time, e.g. 2026-07-06T18:00Z")
+	dt := fs.Duration("step", time.Hour, "Time between isochrones")
+	headingStep := fs.Float64("headings", 5, "Degrees between the headings tried")
+	limit := fs.Duration("max", 30*24*time.Hour, "Give up after this long")
+	out := fs.String("out", "route.gpx", "GPX file to write")
+	tz := fs.String("tz", "Local", "Time zone for local times")
+	fs.BoolVar(&verbose, "verbose", false, "Verbose")
+	fs.StringVar(&stormFlag, "storm", "", "Storm ID (05L) or name for per-storm zones (HAFS)")
+	fs.StringVar(&configFile, "config", "", "Zone & model config file (JSON or TOML) merged over the built-in definitions")
+	fs.Parse(arguments)
+
+	fail := func(err error) {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
+	}
+	if err := loadConfigs(); err != nil {
+		fail(fmt.Errorf("Config: %v", err))
+	}
+	if *polarFile == "" || *from == "" || *to == "" || *startFlag == "" {
+		fail(fmt.Errorf("-polar, -from, -to and -start are required"))
+	}
+	if *dt <= 0 || *headingStep <= 0 || *headingStep > 90 {
+		fail(fmt.Errorf("-step must be positive and -headings between 0 and 90"))
+	}
+	p, err := readPolar(*polarFile)
+	if err != nil {
+		fail(err)
+	}
+	start, err := parseLatLon(*from)
+	if err != nil {
+		fail(err)
+	}
+	finish, err := parseLatLon(*to)
+	if err != nil {
+		fail(err)
+	}
+	departure, err := parseStart(*startFlag)
+	if err != nil {
+		fail(err)
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		fail(err)
+	}
+	series, err := loadSeriesList(*regions, *files)
+	if err != nil {
+		fail(err)
+	}
+
+	steps, arrival, err := isochroneRoute(start, finish, departure, *dt, *limit, series, p, *headingStep)
+	if err != nil {
+		fail(err)
+	}
+	if err := writeRouteGPX(*out, steps, finish, arrival); err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("%4s  %-17s %-17s %8s %9s %4s %5s %5s %4s %4s %5s %4s %7s\n",
+		"step", "UTC", "local", "lat", "lon", "hdg", "bsp", "tws", "twd", "twa", "drift", "set", "dtf nm")
+	for i, st := range steps {
+		n, c := st.node, st.node.c
+		// The heading and speed out of this point are the next node's
+		hdg, bsp := math.NaN(), math.NaN()
+		if i+1 < len(steps) {
+			hdg, bsp = steps[i+1].node.heading, steps[i+1].node.bsp
+		} else {
+			hdg = gcBearing(n.lat, n.lon, finish.lat, finish.lon)
+			bsp = p.courseSpeed(windAngle(hdg, c.twd), c.tws)
+		}
+		fmt.Printf("%4d  %-17s %-17s %8.3f %9.3f %4.0f %5.1f %5s %4s %4s %5s %4s %7.1f\n",
+			i, st.t.Format("2006-01-02 15:04"), st.t.In(loc).Format("2006-01-02 15:04"), n.lat, n.lon, hdg, bsp,
+			cell("%.1f", c.tws), cell("%.0f", c.twd), cell("%.0f", windAngle(hdg, c.twd)), cell("%.1f", c.drift), cell("%.0f", c.set),
+			gcDistance(n.lat, n.lon, finish.lat, finish.lon))
+	}
+	fmt.Printf("Finish %s (%s local), %.1f hours\n", arrival.Format("2006-01-02 15:04"), arrival.In(loc).Format("2006-01-02 15:04"), arrival.Sub(departure).Hours())
+	log.Printf("Route in %s\n", *out)
+}
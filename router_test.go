@@ -0,0 +1,120 @@
+package main
+
+import "math"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+func TestParseLatLon(t *testing.T) {
+	if got, err := parseLatLon(" 37.8, -122.7"); err != nil || got.lat != 37.8 || got.lon != -122.7 {
+		t.Errorf("got %v %v", got, err)
+	}
+	for _, bad := range []string{"", "37.8", "north,-122.7", "95,-122.7"} {
+		if _, err := parseLatLon(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+// 10 miles to a finish due east with a 20 knot northerly (8.1 knots on
+// the beam) and a 2 knot current
+func TestFinishFrom(t *testing.T) {
+	p, err := readPolar(writeTestPolar(t, testPolar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	finish := waypoint{lat: 37, lon: -123}
+	lon := -123 - 10/(60*math.Cos(radians(37)))
+	d := gcDistance(37, lon, finish.lat, finish.lon)
+	tests := []struct {
+		set, sog float64
+		dt       time.Duration
+		ok       bool
+	}{
+		{90, 10.1, time.Hour, true},                      // Behind the boat
+		{270, 6.1, time.Hour, false},                     // Against it
+		{270, 6.1, 2 * time.Hour, true},                  // Against it, with longer to get there
+		{0, math.Sqrt(8.1*8.1 - 4), 2 * time.Hour, true}, // Across the course
+	}
+	for _, tc := range tests {
+		n := &isoNode{lat: 37, lon: lon, c: conditions{tws: 20, twd: 0, drift: 2, set: tc.set}}
+		need, ok := finishFrom(n, finish, tc.dt, p)
+		want := time.Duration(d / tc.sog * float64(time.Hour))
+		if ok != tc.ok || math.Abs(need.Seconds()-want.Seconds()) > 5 {
+			t.Errorf("current setting %g: %v %v, want %v %v", tc.set, need, ok, want, tc.ok)
+		}
+	}
+}
+
+// A composite with the same 10 m wind everywhere every 3 hours for 12 hours
+func writeTestWind(t *testing.T, u, v float64) *gribSeries {
+	t.Helper()
+	g := testLatLonGrid(9, 5, 39, 236, 0.5)
+	field := func(x float64) []float64 {
+		vals := make([]float64, g.nx*g.ny)
+		for i := range vals {
+			vals[i] = x
+		}
+		return vals
+	}
+	var data []byte
+	for h := 0; h <= 12; h += 3 {
+		data = append(data, testMessage(g, 2, 2, h, 2, field(u))...)
+		data = append(data, testMessage(g, 2, 3, h, 2, field(v))...)
+	}
+	fn := filepath.Join(t.TempDir(), "wind.grb2")
+	if err := os.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSeries(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// A 20 knot northerly puts a course due east on the beam at 8.1 knots
+func TestIsochroneRoute(t *testing.T) {
+	p, err := readPolar(writeTestPolar(t, testPolar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := []*gribSeries{writeTestWind(t, 0, -20*metresPerSecondPerKnot)}
+	start, finish := waypoint{lat: 37, lon: -123}, waypoint{lat: 37, lon: -122}
+	departure := time.Date(2026, 7, 6, 12, 0, 0, 0, time.UTC)
+
+	steps, arrival, err := isochroneRoute(start, finish, departure, time.Hour, 12*time.Hour, series, p, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gcDistance(37, -123, 37, -122) / 8.1
+	if got := arrival.Sub(departure).Hours(); got < want || got > want*1.05 {
+		t.Errorf("%.2f hours, want %.2f", got, want)
+	}
+	if len(steps) != int(want)+1 || steps[0].node.lat != 37 || !steps[1].t.Equal(departure.Add(time.Hour)) {
+		t.Errorf("%d steps from %v", len(steps), steps[0])
+	}
+	for _, st := range steps[1:] {
+		if math.Abs(st.node.heading-90) > 5 || math.Abs(st.node.bsp-8.1) > 0.2 {
+			t.Errorf("%v: heading %g at %g", st.t, st.node.heading, st.node.bsp)
+		}
+	}
+
+	fn := filepath.Join(t.TempDir(), "route.gpx")
+	if err := writeRouteGPX(fn, steps, finish, arrival); err != nil {
+		t.Fatal(err)
+	}
+	wps, err := readCourse(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wps) != len(steps)+1 || wps[len(wps)-1].name != "Finish" {
+		t.Errorf("%v", wps)
+	}
+
+	// Past the end of the forecast
+	if _, _, err := isochroneRoute(start, waypoint{lat: 37, lon: -100}, departure, time.Hour, 48*time.Hour, series, p, 5); err == nil {
+		t.Error("no error beyond the forecast")
+	}
+}
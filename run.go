@@ -0,0 +1,61 @@
+package main
+
+import "context"
+import "fmt"
+import "strings"
+import "time"
+
+// -run names the model run to fetch instead of counting back with -prev:
+// a cycle time like 2026-10-15T12Z, or latest-complete / latest-started.
+
+var runFlag string
+
+// Cycle layouts -run accepts
+var runLayouts = []string{
+	"2006-01-02T15Z",
+	"2006-01-02T15:04Z",
+	"2006-01-02T15:04:05Z",
+	"2006-01-02T15",
+	"2006010215",
+}
+
+// Parse -run. The keywords give a zero time.
+func parseRun(s string) (time.Time, error) {
+	switch s {
+	case "latest-complete", "latest-started":
+		return time.Time{}, nil
+	}
+	u := strings.ToUpper(s)
+	for _, layout := range runLayouts {
+		if t, err := time.Parse(layout, u); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad -run %q: use a cycle like 2026-10-15T12Z, latest-complete or latest-started", s)
+}
+
+// The run -run names for the current model
+func namedRun(ctx context.Context, utc time.Time, s string) (run, forecastLast time.Time, inProgress bool, err error) {
+	switch s {
+	case "latest-complete":
+		run, forecastLast, inProgress = chooseRun(ctx, utc, 0, false)
+		return run, forecastLast, inProgress, nil
+	case "latest-started":
+		run, forecastLast, inProgress = chooseRun(ctx, utc, 0, true)
+		return run, forecastLast, inProgress, nil
+	}
+	run, err = parseRun(s)
+	if err != nil {
+		return run, forecastLast, false, err
+	}
+	modelFrequency, _ := time.ParseDuration(M.modelFrequency)
+	if !run.Truncate(modelFrequency).Equal(run) {
+		return run, forecastLast, false, fmt.Errorf("%s runs every %s - there's no %02d:%02dz cycle", Z.model, M.modelFrequency, run.Hour(), run.Minute())
+	}
+	if run.After(utc) {
+		return run, forecastLast, false, fmt.Errorf("the %s run is in the future", run.Format("2006-01-02 15z"))
+	}
+	_, endLag := modelLags(run)
+	forecastLast = run.Add(endLag)
+	return run, forecastLast, utc.Before(forecastLast), nil
+}
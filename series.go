@@ -0,0 +1,210 @@
+package main
+
+import "context"
+import "fmt"
+import "math"
+import "path/filepath"
+import "sort"
+import "strings"
+import "time"
+
+// Reading a fetched composite back: its fields by valid time, and their
+// values at a latitude and longitude. Winds are rotated to earth-relative
+// on the way in. A composite with several fields for the same variable at
+// a step (ensemble members) gives the first.
+
+type gribSeries struct {
+	fn    string
+	times []time.Time
+	steps map[time.Time]map[string]*seriesField
+	keys  []string // Variables in the order first seen
+}
+
+type seriesField struct {
+	f        *grib2Field
+	grid     *gribGrid
+	vals     []float64 // Unpacked on first use
+	sin, cos []float64 // Of a direction's values
+}
+
+// Variable and level, e.g. UGRD:10_m_above_ground
+func fieldKey(f *grib2Field) string {
+	return f.name() + ":" + levelName(f.level1, f.level2)
+}
+
+func loadSeries(fn string) (*gribSeries, error) {
+	msgs, err := readGrib2File(fn)
+	if err != nil {
+		return nil, err
+	}
+	s := &gribSeries{fn: fn, steps: map[time.Time]map[string]*seriesField{}}
+	seen := map[string]bool{}
+	for _, f := range rotateWinds(gribFields(msgs)) {
+		g, err := f.grid()
+		if err != nil || !f.unpackable() {
+			continue
+		}
+		t := f.validTime()
+		if s.steps[t] == nil {
+			s.steps[t] = map[string]*seriesField{}
+			s.times = append(s.times, t)
+		}
+		key := fieldKey(f)
+		if _, ok := s.steps[t][key]; !ok {
+			s.steps[t][key] = &seriesField{f: f, grid: g}
+		}
+		if !seen[key] {
+			seen[key] = true
+			s.keys = append(s.keys, key)
+		}
+	}
+	if len(s.times) == 0 {
+		return nil, fmt.Errorf("%s: no fields", filepath.Base(fn))
+	}
+	sort.Slice(s.times, func(i, j int) bool { return s.times[i].Before(s.times[j]) })
+	return s, nil
+}
+
+// The field's value at a point, NaN off the grid
+func (sf *seriesField) at(lat, lon float64) float64 {
+	if sf.vals == nil {
+		vals, err := sf.f.values()
+		if err != nil {
+			return math.NaN()
+		}
+		sf.vals = vals
+		if directionParams[sf.f.name()] {
+			sf.sin, sf.cos = directionComponents(vals)
+		}
+	}
+	i, j := sf.grid.index(lat, lon)
+	if sf.sin != nil {
+		return componentDirection(sf.grid.bilinear(sf.sin, i, j), sf.grid.bilinear(sf.cos, i, j))
+	}
+	return sf.grid.bilinear(sf.vals, i, j)
+}
+
+// The variable at a point at a step, NaN if the step doesn't have it
+func (s *gribSeries) stepValue(key string, t time.Time, lat, lon float64) float64 {
+	sf, ok := s.steps[t][key]
+	if !ok {
+		return math.NaN()
+	}
+	return sf.at(lat, lon)
+}
+
+// The variable at a point at any time, interpolated between the steps
+// either side - the short way round for a direction. NaN outside the run.
+func (s *gribSeries) value(key string, t time.Time, lat, lon float64) float64 {
+	n := sort.Search(len(s.times), func(i int) bool { return !s.times[i].Before(t) })
+	switch {
+	case n < len(s.times) && s.times[n].Equal(t):
+		return s.stepValue(key, t, lat, lon)
+	case n == 0 || n == len(s.times):
+		return math.NaN()
+	}
+	t0, t1 := s.times[n-1], s.times[n]
+	w := float64(t.Sub(t0)) / float64(t1.Sub(t0))
+	v0, v1 := s.stepValue(key, t0, lat, lon), s.stepValue(key, t1, lat, lon)
+	if name, _, _ := strings.Cut(key, ":"); directionParams[name] {
+		r0, r1 := radians(v0), radians(v1)
+		return componentDirection((1-w)*math.Sin(r0)+w*math.Sin(r1), (1-w)*math.Cos(r0)+w*math.Cos(r1))
+	}
+	return (1-w)*v0 + w*v1
+}
+
+// The reference time of the fields at a step
+func (s *gribSeries) refTime(t time.Time) time.Time {
+	for _, sf := range s.steps[t] {
+		return sf.f.refTime
+	}
+	return time.Time{}
+}
+
+// The newest composite for a zone in dir. A per-storm zone's composites
+// have the storm ID in the geo; the storm is -storm or the zone's, by ID or
+// by name as selectStorm finds it, else the only storm with a composite.
+func latestComposite(ctx context.Context, dir, id string) (string, error) {
+	z := zones[id]
+	pattern := "*_" + z.geo + "_" + z.model + ".grb2"
+	switch {
+	case len(z.blend) > 0:
+		pattern = "*_" + z.geo + "_blend.grb2"
+	case models[z.model].stormurl != "":
+		pattern = "*_" + z.geo + "-*_" + z.model + ".grb2"
+	}
+	found, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return "", err
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("no %s composite in %s", id, dir)
+	}
+	sort.Strings(found) // Named by date
+	if models[z.model].stormurl != "" {
+		if found, err = stormComposites(ctx, z, found); err != nil {
+			return "", fmt.Errorf("%s: %v", id, err)
+		}
+	}
+	return found[len(found)-1], nil
+}
+
+// The zone's storm's composites out of found, which is sorted by date
+func stormComposites(ctx context.Context, z Zone, found []string) ([]string, error) {
+	const runLayout = "2006-01-02_15z"
+	byStorm := map[string][]string{}
+	var ids []string
+	for _, fn := range found {
+		// 2026-07-06_12z_hafs-05l_hafs-storm.grb2
+		name := strings.TrimSuffix(filepath.Base(fn), "_"+z.model+".grb2")
+		id := strings.ToUpper(strings.TrimPrefix(name[len(runLayout)+1:], z.geo+"-"))
+		if byStorm[id] == nil {
+			ids = append(ids, id)
+		}
+		byStorm[id] = append(byStorm[id], fn)
+	}
+	want := wantedStorm(z)
+	switch {
+	case want == "" && len(ids) > 1:
+		return nil, fmt.Errorf("choose a storm with -storm: %s", strings.Join(ids, ", "))
+	case want == "":
+		return found, nil
+	case byStorm[want] != nil:
+		return byStorm[want], nil
+	}
+
+	// A name - look it up in the storms of the newest composite's run
+	run, err := time.Parse(runLayout, filepath.Base(found[len(found)-1])[:len(runLayout)])
+	if err != nil {
+		return nil, err
+	}
+	saveM, saveZulu := M, zulu
+	defer func() { M, zulu = saveM, saveZulu }()
+	M, zulu = models[z.model], run
+	storms, err := activeStorms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := matchStorm(storms, want)
+	if err != nil {
+		return nil, err
+	}
+	if byStorm[s.id] == nil {
+		return nil, fmt.Errorf("no composite for storm %s %s", s.id, s.name)
+	}
+	return byStorm[s.id], nil
+}
+
+// Display units for a variable, and the conversion from the GRIB units
+func displayUnits(key string) (string, func(float64) float64) {
+	name, _, _ := strings.Cut(key, ":")
+	switch name {
+	case "UGRD", "VGRD", "WIND", "GUST", "USTM", "VSTM", "UOGRD", "VOGRD", "SPC":
+		return "kt", func(v float64) float64 { return v / metresPerSecondPerKnot }
+	case "TMP", "DPT", "TMAX", "TMIN", "WTMP":
+		return "C", func(v float64) float64 { return v - 273.15 }
+	case "PRES", "PRMSL", "MSLET", "MSLMA":
+		return "hPa", func(v float64) float64 { return v / 100 }
+	}
+	return "", func(v float64) float64 { return v }
+}
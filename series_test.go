@@ -0,0 +1,122 @@
+package main
+
+import "context"
+import "math"
+import "net/http"
+import "net/http/httptest"
+import "os"
+import "path/filepath"
+import "strings"
+import "testing"
+import "time"
+
+// Wind from 350 degrees in the west and 10 in the east at 6 hours, and from
+// 20 everywhere at 9: directions interpolate the short way round, in space
+// and in time
+func TestSeriesDirections(t *testing.T) {
+	g := testLatLonGrid(2, 2, 38, 237, 1)
+	data := append(testMessage(g, 2, 0, 6, 0, []float64{350, 10, 350, 10}), testMessage(g, 2, 0, 9, 0, []float64{20, 20, 20, 20})...)
+	fn := filepath.Join(t.TempDir(), "wdir.grb2")
+	if err := os.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSeries(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := time.Date(2026, 7, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		hours    float64
+		lon      float64
+		want     float64
+		describe string
+	}{
+		{6, -123, 350, "west"},
+		{6, -122.5, 0, "halfway across"},
+		{6, -122.75, 355, "a quarter of the way across"},
+		{9, -122.5, 20, "later"},
+		{7.5, -123, 5, "halfway from 350 to 20"},
+	}
+	for _, tc := range tests {
+		at := run.Add(time.Duration(tc.hours * float64(time.Hour)))
+		got := s.value("WDIR:10_m_above_ground", at, 37.5, tc.lon)
+		if math.IsNaN(got) || math.Abs(math.Remainder(got-tc.want, 360)) > 0.1 {
+			t.Errorf("%s: %g, want %g", tc.describe, got, tc.want)
+		}
+	}
+
+	// Anything else interpolates as it is
+	data = testMessage(g, 0, 0, 6, 0, []float64{350, 10, 350, 10})
+	if err := os.WriteFile(fn, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = loadSeries(fn); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.value("TMP:10_m_above_ground", run.Add(6*time.Hour), 37.5, -122.5); got != 180 {
+		t.Errorf("TMP halfway across %g, want 180", got)
+	}
+}
+
+func TestLatestComposite(t *testing.T) {
+	saveStorm, saveHafs, saveModel := stormFlag, zones["hafs"], models["hafs-storm"]
+	defer func() { stormFlag, zones["hafs"], models["hafs-storm"] = saveStorm, saveHafs, saveModel }()
+
+	// The storms in the 12z cycle, two of them unnamed
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/20260706/12/tcvitals" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("NHC  05L BERYL     20260706 1200 190N 0838W 290 082 0989 1008\n" +
+			"NHC  06L INVEST    20260706 1200 150N 0450W 270 050 1009 1012\n" +
+			"NHC  07L INVEST    20260706 1200 120N 0300W 270 050 1010 1012\n"))
+	}))
+	defer ts.Close()
+	m := models["hafs-storm"]
+	m.stormurl = ts.URL + "/{{.Date}}/{{.Cycle}}/tcvitals"
+	models["hafs-storm"] = m
+
+	dir := t.TempDir()
+	for _, name := range []string{
+		"2026-07-06_06z_hafs-05l_hafs-storm",
+		"2026-07-06_12z_hafs-05l_hafs-storm",
+		"2026-07-06_06z_hafs-06l_hafs-storm",
+		"2026-07-06_12z_sf_hrrr",
+		"2026-07-06_18z_sf_hrrr",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name+".grb2"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		zone, zoneStorm, flag string
+		want                  string // Composite, or the start of the error
+	}{
+		{"sf", "", "", "2026-07-06_18z_sf_hrrr"},
+		{"hafs", "", "", "hafs: choose a storm with -storm: 05L, 06L"},
+		{"hafs", "", "06l", "2026-07-06_06z_hafs-06l_hafs-storm"},
+		{"hafs", "05L", "", "2026-07-06_12z_hafs-05l_hafs-storm"},
+		{"hafs", "06L", "05L", "2026-07-06_12z_hafs-05l_hafs-storm"},
+		{"hafs", "", "beryl", "2026-07-06_12z_hafs-05l_hafs-storm"},
+		{"hafs", "", "invest", "hafs: choose a storm with -storm: 06L INVEST, 07L INVEST"},
+		{"hafs", "", "07L", "hafs: no composite for storm 07L INVEST"},
+		{"hafs", "", "debby", "hafs: storm DEBBY isn't active"},
+		{"hafs-florida", "", "", "no hafs-florida composite"},
+	}
+	for _, tc := range tests {
+		z := saveHafs
+		z.storm = tc.zoneStorm
+		zones["hafs"], stormFlag = z, tc.flag
+		fn, err := latestComposite(context.Background(), dir, tc.zone)
+		got := strings.TrimSuffix(filepath.Base(fn), ".grb2")
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.HasPrefix(got, tc.want) {
+			t.Errorf("%s storm %q -storm %q: %s, want %s", tc.zone, tc.zoneStorm, tc.flag, got, tc.want)
+		}
+	}
+}
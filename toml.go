@@ -0,0 +1,585 @@
+package main
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "math"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+
+// Config files can be TOML as well as JSON. A TOML file is read into tables
+// and written out as JSON, so it's decoded and checked exactly like a JSON
+// one, with errors mapped back to the TOML file's lines. The parts of TOML a
+// config needs are supported: [tables], [[arrays of tables]], dotted and
+// quoted keys, basic and literal strings, integers, floats, booleans, arrays
+// and inline tables. Multi-line strings and dates aren't.
+//
+// [zones.rbyc]
+// description = "Richardson Bay (18 hour hrrr)"
+// geo = "rbyc"
+// model = "hrrr"
+// longitude = [-122.6, -122.3]
+// latitude = [38.0, 37.8]
+// modelLevels = ["10_m_above_ground"]
+// modelVars = ["UGRD", "VGRD", "GUST"]
+//
+// [models.hrrr]
+// end = "95m"
+// horizons = { 0 = "48h", 6 = "48h", 12 = "48h", 18 = "48h" }
+
+type tomlPos struct {
+	line, col int
+}
+
+type tomlError struct {
+	pos tomlPos
+	msg string
+}
+
+func (e *tomlError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.pos.line, e.pos.col, e.msg)
+}
+
+type tomlValue struct {
+	pos    tomlPos
+	v      any  // string, tomlNumber, bool, []*tomlValue or *tomlTable
+	tables bool // An array of tables, which [[key]] can add to
+}
+
+// A number as JSON text
+type tomlNumber string
+
+type tomlEntry struct {
+	key string
+	pos tomlPos
+	val *tomlValue
+}
+
+type tomlTable struct {
+	entries  []*tomlEntry // In file order
+	implicit bool         // Only named in a longer [table] so far
+	inline   bool         // Inline tables are complete
+}
+
+func (t *tomlTable) get(key string) *tomlValue {
+	for _, e := range t.entries {
+		if e.key == key {
+			return e.val
+		}
+	}
+	return nil
+}
+
+func (t *tomlTable) set(key string, pos tomlPos, v *tomlValue) {
+	t.entries = append(t.entries, &tomlEntry{key: key, pos: pos, val: v})
+}
+
+// The table a key leads to on the way to a longer key, made if it's not
+// there yet. Through an array of tables it's the last one.
+func (t *tomlTable) sub(key string, pos tomlPos, implicit bool) (*tomlTable, error) {
+	v := t.get(key)
+	if v == nil {
+		sub := &tomlTable{implicit: implicit}
+		t.set(key, pos, &tomlValue{pos: pos, v: sub})
+		return sub, nil
+	}
+	switch x := v.v.(type) {
+	case *tomlTable:
+		if x.inline {
+			return nil, &tomlError{pos, fmt.Sprintf("inline table %q can't be extended", key)}
+		}
+		return x, nil
+	case []*tomlValue:
+		if v.tables && len(x) > 0 {
+			return x[len(x)-1].v.(*tomlTable), nil
+		}
+	}
+	return nil, &tomlError{pos, fmt.Sprintf("key %q isn't a table", key)}
+}
+
+type tomlParser struct {
+	data      []byte
+	off       int
+	line, col int
+}
+
+func readTOML(data []byte) (*tomlTable, error) {
+	p := &tomlParser{data: data, line: 1, col: 1}
+	root := &tomlTable{}
+	current := root
+	for {
+		p.skipBlank()
+		if p.off >= len(p.data) {
+			return root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			current, err = p.header(root)
+		} else {
+			err = p.keyValue(current)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *tomlParser) pos() tomlPos {
+	return tomlPos{p.line, p.col}
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return &tomlError{p.pos(), fmt.Sprintf(format, args...)}
+}
+
+func (p *tomlParser) peek() byte {
+	if p.off >= len(p.data) {
+		return 0
+	}
+	return p.data[p.off]
+}
+
+func (p *tomlParser) next() byte {
+	c := p.peek()
+	if p.off < len(p.data) {
+		p.off++
+		if c == '\n' {
+			p.line, p.col = p.line+1, 1
+		} else {
+			p.col++
+		}
+	}
+	return c
+}
+
+func (p *tomlParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.next()
+	return nil
+}
+
+func (p *tomlParser) skipSpace() {
+	for c := p.peek(); c == ' ' || c == '\t'; c = p.peek() {
+		p.next()
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	if p.peek() == '#' {
+		for p.off < len(p.data) && p.peek() != '\n' {
+			p.next()
+		}
+	}
+}
+
+// Spaces, newlines and comments, between lines and inside arrays
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpace()
+		p.skipComment()
+		switch p.peek() {
+		case '\n', '\r':
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+// Nothing but a comment after a key/value or [table]
+func (p *tomlParser) endLine() error {
+	p.skipSpace()
+	p.skipComment()
+	if p.peek() == '\r' {
+		p.next()
+	}
+	if p.off < len(p.data) && p.peek() != '\n' {
+		return p.errorf("expected the end of the line")
+	}
+	p.next()
+	return nil
+}
+
+// A dotted key and where each part of it is
+func (p *tomlParser) key() ([]string, []tomlPos, error) {
+	var keys []string
+	var poses []tomlPos
+	for {
+		p.skipSpace()
+		pos := p.pos()
+		var key string
+		var err error
+		switch c := p.peek(); {
+		case c == '"':
+			key, err = p.basicString()
+		case c == '\'':
+			key, err = p.literalString()
+		default:
+			start := p.off
+			for c := p.peek(); c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'; c = p.peek() {
+				p.next()
+			}
+			if p.off == start {
+				return nil, nil, p.errorf("expected a key")
+			}
+			key = string(p.data[start:p.off])
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		keys, poses = append(keys, key), append(poses, pos)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, poses, nil
+		}
+		p.next()
+	}
+}
+
+// A [table] or [[array of tables]] header, returning the table that
+// following keys go in
+func (p *tomlParser) header(root *tomlTable) (*tomlTable, error) {
+	p.next()
+	array := p.peek() == '['
+	if array {
+		p.next()
+	}
+	keys, poses, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	if array {
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+	}
+
+	t := root
+	last := len(keys) - 1
+	for i, key := range keys[:last] {
+		if t, err = t.sub(key, poses[i], true); err != nil {
+			return nil, err
+		}
+	}
+	key, pos := keys[last], poses[last]
+	v := t.get(key)
+	if array {
+		table := &tomlValue{pos: pos, v: &tomlTable{}}
+		switch {
+		case v == nil:
+			t.set(key, pos, &tomlValue{pos: pos, v: []*tomlValue{table}, tables: true})
+		case v.tables:
+			v.v = append(v.v.([]*tomlValue), table)
+		default:
+			return nil, &tomlError{pos, fmt.Sprintf("key %q isn't an array of tables", key)}
+		}
+		return table.v.(*tomlTable), nil
+	}
+	if v == nil {
+		table := &tomlTable{}
+		t.set(key, pos, &tomlValue{pos: pos, v: table})
+		return table, nil
+	}
+	if table, ok := v.v.(*tomlTable); ok && table.implicit {
+		table.implicit = false
+		return table, nil
+	}
+	return nil, &tomlError{pos, fmt.Sprintf("table %q is already defined", key)}
+}
+
+func (p *tomlParser) keyValue(t *tomlTable) error {
+	keys, poses, err := p.key()
+	if err != nil {
+		return err
+	}
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	p.skipSpace()
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	last := len(keys) - 1
+	for i, key := range keys[:last] {
+		if t, err = t.sub(key, poses[i], false); err != nil {
+			return err
+		}
+	}
+	if t.get(keys[last]) != nil {
+		return &tomlError{poses[last], fmt.Sprintf("key %q is already defined", keys[last])}
+	}
+	t.set(keys[last], poses[last], v)
+	return nil
+}
+
+func (p *tomlParser) value() (*tomlValue, error) {
+	v := &tomlValue{pos: p.pos()}
+	var err error
+	switch p.peek() {
+	case '"':
+		v.v, err = p.basicString()
+	case '\'':
+		v.v, err = p.literalString()
+	case '[':
+		v.v, err = p.array()
+	case '{':
+		v.v, err = p.inlineTable()
+	default:
+		start := p.off
+		for c := p.peek(); c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("_+-.:", c) >= 0; c = p.peek() {
+			p.next()
+		}
+		word := string(p.data[start:p.off])
+		switch word {
+		case "true", "false":
+			v.v = word == "true"
+		default:
+			n, ok := tomlNumberValue(word)
+			if !ok {
+				return nil, &tomlError{v.pos, fmt.Sprintf("invalid value %q", word)}
+			}
+			v.v = n
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Decimal integers and floats, with or without underscores
+func tomlNumberValue(word string) (tomlNumber, bool) {
+	s := strings.TrimPrefix(strings.ReplaceAll(word, "_", ""), "+")
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return "", false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return tomlNumber(strconv.FormatInt(i, 10)), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || strings.ContainsAny(s, "xXpP") {
+		return "", false
+	}
+	return tomlNumber(strconv.FormatFloat(f, 'g', -1, 64)), true
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	if bytes.HasPrefix(p.data[p.off:], []byte(`"""`)) {
+		return "", p.errorf("multi-line strings aren't supported")
+	}
+	p.next()
+	var b strings.Builder
+	for {
+		switch c := p.peek(); c {
+		case '"':
+			p.next()
+			return b.String(), nil
+		case 0, '\n', '\r':
+			return "", p.errorf("unterminated string")
+		case '\\':
+			p.next()
+			esc := p.next()
+			switch esc {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(esc)
+			case 'u', 'U':
+				n := 4
+				if esc == 'U' {
+					n = 8
+				}
+				if p.off+n > len(p.data) {
+					return "", p.errorf("unterminated string")
+				}
+				r, err := strconv.ParseUint(string(p.data[p.off:p.off+n]), 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", p.errorf("invalid escape \\%c%s", esc, p.data[p.off:p.off+n])
+				}
+				for i := 0; i < n; i++ {
+					p.next()
+				}
+				b.WriteRune(rune(r))
+			default:
+				return "", p.errorf("invalid escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(p.next())
+		}
+	}
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	if bytes.HasPrefix(p.data[p.off:], []byte(`'''`)) {
+		return "", p.errorf("multi-line strings aren't supported")
+	}
+	p.next()
+	start := p.off
+	for {
+		switch p.peek() {
+		case '\'':
+			s := string(p.data[start:p.off])
+			p.next()
+			return s, nil
+		case 0, '\n', '\r':
+			return "", p.errorf("unterminated string")
+		}
+		p.next()
+	}
+}
+
+// Arrays can run over several lines, with comments and a trailing comma
+func (p *tomlParser) array() ([]*tomlValue, error) {
+	p.next()
+	vals := []*tomlValue{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.next()
+			return vals, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+// Inline tables are on one line, without a trailing comma
+func (p *tomlParser) inlineTable() (*tomlTable, error) {
+	p.next()
+	t := &tomlTable{}
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.next()
+		t.inline = true
+		return t, nil
+	}
+	for {
+		if err := p.keyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.next()
+		case '}':
+			p.next()
+			t.inline = true
+			return t, nil
+		default:
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+// Where a key or value written as JSON came from
+type tomlMark struct {
+	start, end int64
+	key        bool
+	pos        tomlPos
+}
+
+type tomlEncoder struct {
+	buf   bytes.Buffer
+	marks []tomlMark
+}
+
+// The table as JSON, and a function from an offset in the JSON to the line
+// and column in the TOML file
+func (t *tomlTable) json() ([]byte, func(int64) (int, int)) {
+	var e tomlEncoder
+	e.table(t)
+	return e.buf.Bytes(), e.lineCol
+}
+
+func (e *tomlEncoder) table(t *tomlTable) {
+	e.buf.WriteByte('{')
+	for i, entry := range t.entries {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		start := int64(e.buf.Len())
+		e.marks = append(e.marks, tomlMark{start: start, end: start, key: true, pos: entry.pos})
+		e.str(entry.key)
+		e.buf.WriteByte(':')
+		e.value(entry.val)
+	}
+	e.buf.WriteByte('}')
+}
+
+func (e *tomlEncoder) value(v *tomlValue) {
+	start := int64(e.buf.Len())
+	switch x := v.v.(type) {
+	case string:
+		e.str(x)
+	case tomlNumber:
+		e.buf.WriteString(string(x))
+	case bool:
+		e.buf.WriteString(strconv.FormatBool(x))
+	case []*tomlValue:
+		e.buf.WriteByte('[')
+		for i, elem := range x {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.value(elem)
+		}
+		e.buf.WriteByte(']')
+	case *tomlTable:
+		e.table(x)
+	}
+	e.marks = append(e.marks, tomlMark{start: start, end: int64(e.buf.Len()), pos: v.pos})
+}
+
+func (e *tomlEncoder) str(s string) {
+	b, _ := json.Marshal(s)
+	e.buf.Write(b)
+}
+
+// A key starting at the offset, or else the innermost value the offset is
+// in or just after - encoding/json reports a bad value by where it ends
+func (e *tomlEncoder) lineCol(offset int64) (line, col int) {
+	best := -1
+	for i, m := range e.marks {
+		if m.key && m.start == offset {
+			return m.pos.line, m.pos.col
+		}
+		if !m.key && m.start < offset && offset <= m.end && (best < 0 || m.start > e.marks[best].start) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 1, 1
+	}
+	return e.marks[best].pos.line, e.marks[best].pos.col
+}
@@ -0,0 +1,115 @@
+package main
+
+import "fmt"
+import "math"
+import "strconv"
+import "strings"
+import "sync"
+import "text/template"
+import "time"
+
+// A model's baseurl, baseurlfn, mirrorurl and probeurl are text/template
+// strings so models from config files can say where their files are:
+//
+//   {{.Model}}.t{{.Cycle}}z.pgrb2.0p25.f{{pad 3 .FHour}}
+//   https://noaa-gfs-bdp-pds.s3.amazonaws.com/gfs.{{.Date}}/{{.Cycle}}/atmos/{{.File}}
+//
+// baseurlfn is expanded first and is .File in the others.
+
+type urlData struct {
+	Model  string // The model's fn, e.g. gfs
+	Date   string // Run date, YYYYMMDD
+	Year   string
+	Month  string
+	Day    string
+	Cycle  string // Run hour, HH
+	FHour  int    // Forecast hour
+	Storm  string // Per-storm models: storm ID, 05l
+	File   string // The expanded baseurlfn
+	Levels string // Filter script arguments for the zone's levels, &lev_surface=on...
+	Vars   string // and variables, &var_UGRD=on...
+	West   string // The zone, in degrees
+	East   string
+	North  string
+	South  string
+}
+
+var urlFuncs = template.FuncMap{
+	// Zero padded forecast hours - pad 3 .FHour is 006
+	"pad": func(width, n int) string { return fmt.Sprintf("%0*d", width, n) },
+}
+
+var urlTemplatesMu sync.Mutex
+var urlTemplates = map[string]*template.Template{}
+
+func parseUrlTemplate(pattern string) (*template.Template, error) {
+	urlTemplatesMu.Lock()
+	defer urlTemplatesMu.Unlock()
+	if t, ok := urlTemplates[pattern]; ok {
+		return t, nil
+	}
+	t, err := template.New("url").Funcs(urlFuncs).Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+	urlTemplates[pattern] = t
+	return t, nil
+}
+
+func expandUrl(pattern string, data urlData) (string, error) {
+	t, err := parseUrlTemplate(pattern)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err = t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// No exponents, and no 24.200000000000003 from arithmetic on the bbox
+func degreesString(d float64) string {
+	return strconv.FormatFloat(math.Round(d*1e4)/1e4, 'f', -1, 64)
+}
+
+// Template data for the zone's forecast of a run, with File filled in. An
+// ensemble member's files are named for it rather than the model.
+func newUrlData(run time.Time, forecast int, member, levels, vars string) (urlData, error) {
+	d := urlData{
+		Model:  M.fn,
+		Date:   run.Format("20060102"),
+		Year:   run.Format("2006"),
+		Month:  run.Format("01"),
+		Day:    run.Format("02"),
+		Cycle:  run.Format("15"),
+		FHour:  forecast,
+		Storm:  strings.ToLower(storm.id),
+		Levels: levels,
+		Vars:   vars,
+		West:   degreesString(Z.longitude.west),
+		East:   degreesString(Z.longitude.east),
+		North:  degreesString(Z.latitude.north),
+		South:  degreesString(Z.latitude.south),
+	}
+	if member != "" {
+		d.Model = member
+	}
+	var err error
+	d.File, err = expandUrl(M.baseurlfn, d)
+	return d, err
+}
+
+// Check a model's templates expand
+func checkUrlTemplates(m Model) error {
+	d := urlData{File: "file"}
+	for name, pattern := range map[string]string{"baseurl": m.baseurl, "baseurlfn": m.baseurlfn, "mirrorurl": m.mirrorurl, "probeurl": m.probeurl, "stormurl": m.stormurl} {
+		if pattern == "" {
+			continue
+		}
+		if _, err := expandUrl(pattern, d); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
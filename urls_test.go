@@ -0,0 +1,68 @@
+package main
+
+import "strings"
+import "testing"
+import "time"
+
+func TestExpandUrl(t *testing.T) {
+	saveM, saveZ := M, Z
+	defer func() { M, Z = saveM, saveZ }()
+	Z = Zone{longitude: Longitude{-123.5, -121}, latitude: Latitude{39, 36.25}}
+	run := time.Date(2026, 7, 6, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		model    string
+		member   string
+		forecast int
+		file     string
+		url      string
+		mirror   string
+	}{
+		{"gfs", "", 6, "gfs.t06z.pgrb2.0p25.f006",
+			"https://nomads.ncep.noaa.gov/cgi-bin/filter_gfs_0p25.pl?file=gfs.t06z.pgrb2.0p25.f006&lev_surface=on&var_TMP=on&subregion=&leftlon=-123.5&rightlon=-121&toplat=39&bottomlat=36.25&dir=%2Fgfs.20260706%2F06%2Fatmos",
+			"https://noaa-gfs-bdp-pds.s3.amazonaws.com/gfs.20260706/06/atmos/gfs.t06z.pgrb2.0p25.f006"},
+		{"hrrr", "", 18, "hrrr.t06z.wrfsfcf18.grib2",
+			"https://nomads.ncep.noaa.gov/cgi-bin/filter_hrrr_2d.pl?file=hrrr.t06z.wrfsfcf18.grib2&lev_surface=on&var_TMP=on&subregion=&leftlon=-123.5&rightlon=-121&toplat=39&bottomlat=36.25&dir=%2Fhrrr.20260706%2Fconus",
+			"https://noaa-hrrr-bdp-pds.s3.amazonaws.com/hrrr.20260706/conus/hrrr.t06z.wrfsfcf18.grib2"},
+		{"gfs-ensemble-25", "gep07", 120, "gep07.t06z.pgrb2s.0p25.f120",
+			"https://nomads.ncep.noaa.gov/cgi-bin/filter_gefs_atmos_0p25s.pl?file=gep07.t06z.pgrb2s.0p25.f120&lev_surface=on&var_TMP=on&subregion=&leftlon=-123.5&rightlon=-121&toplat=39&bottomlat=36.25&dir=%2Fgefs.20260706%2F06%2Fatmos%2Fpgrb2sp25",
+			"https://noaa-gefs-pds.s3.amazonaws.com/gefs.20260706/06/atmos/pgrb2sp25/gep07.t06z.pgrb2s.0p25.f120"},
+	}
+	for _, tc := range tests {
+		M = models[tc.model]
+		d, err := newUrlData(run, tc.forecast, tc.member, "&lev_surface=on", "&var_TMP=on")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.File != tc.file {
+			t.Errorf("%s file %s, want %s", tc.model, d.File, tc.file)
+		}
+		for _, u := range []struct{ pattern, want string }{{M.baseurl, tc.url}, {M.mirrorurl, tc.mirror}} {
+			if got, err := expandUrl(u.pattern, d); err != nil || got != u.want {
+				t.Errorf("%s: %s %v\nwant %s", tc.model, got, err, u.want)
+			}
+		}
+	}
+}
+
+func TestCheckUrlTemplates(t *testing.T) {
+	for id, m := range models {
+		if err := checkUrlTemplates(m); err != nil {
+			t.Errorf("model %s: %v", id, err)
+		}
+	}
+	tests := []struct {
+		m    Model
+		want string
+	}{
+		{Model{baseurl: "https://example.com/{{.File}", baseurlfn: "f"}, "baseurl:"},
+		{Model{baseurl: "https://example.com/{{.File}}", baseurlfn: "{{.Hour}}"}, "baseurlfn:"},
+		{Model{baseurl: "https://example.com/{{.File}}", baseurlfn: "f{{pad 3}}"}, "baseurlfn:"},
+		{Model{baseurl: "https://example.com/{{.File}}", baseurlfn: "f", mirrorurl: "{{.file}}"}, "mirrorurl:"},
+	}
+	for _, tc := range tests {
+		if err := checkUrlTemplates(tc.m); err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("%+v: %v", tc.m, err)
+		}
+	}
+}